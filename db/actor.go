@@ -0,0 +1,140 @@
+package db
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 操作人字段标记，如 `dubhe:"created_by"`
+const (
+	TagCreatedBy = "created_by"
+	TagUpdatedBy = "updated_by"
+	TagDeletedBy = "deleted_by"
+)
+
+// ModelAudited 带操作人字段的基础模型，Create/Update/软删除时按 RepoCfg.ActorFromContext 自动赋值
+type ModelAudited[T ID] struct {
+	ModelT[T]
+	CreatedBy string `gorm:"size:128" dubhe:"created_by" json:"created_by"`
+	UpdatedBy string `gorm:"size:128" dubhe:"updated_by" json:"updated_by"`
+	DeletedBy string `gorm:"size:128" dubhe:"deleted_by" json:"deleted_by"`
+}
+
+// actorFields 模型中通过 dubhe 标记声明的操作人字段
+type actorFields struct {
+	created, updated, deleted *schema.Field
+	softDelete                bool // 模型包含 gorm.DeletedAt，Del 为软删除
+}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+func actorFieldsOf(sch *schema.Schema) actorFields {
+	var fs actorFields
+	for _, field := range sch.Fields {
+		switch field.Tag.Get("dubhe") {
+		case TagCreatedBy:
+			fs.created = field
+		case TagUpdatedBy:
+			fs.updated = field
+		case TagDeletedBy:
+			fs.deleted = field
+		}
+		if field.FieldType == deletedAtType {
+			fs.softDelete = true
+		}
+	}
+	return fs
+}
+
+// actor 当前操作人，RepoCfg.ActorFromContext 未设置时读取 WithActor 写入的上下文
+func (r *Repo[T, K]) actor() string {
+	if r.cfg.ActorFromContext != nil {
+		return r.cfg.ActorFromContext(r.context())
+	}
+	return ActorFrom(r.context())
+}
+
+// actorFields 解析模型的操作人字段
+func (r *Repo[T, K]) actorFields(db *gorm.DB) (actorFields, error) {
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return actorFields{}, err
+	}
+	return actorFieldsOf(sch), nil
+}
+
+// stampCreated 新增时赋值 created_by（未手动赋值时）与 updated_by
+func (r *Repo[T, K]) stampCreated(db *gorm.DB, ts ...*T) error {
+	actor := r.actor()
+	if actor == "" || len(ts) == 0 {
+		return nil
+	}
+	fs, err := r.actorFields(db)
+	if err != nil {
+		return err
+	}
+	ctx := r.context()
+	for _, t := range ts {
+		if t == nil {
+			continue
+		}
+		rv := reflect.ValueOf(t).Elem()
+		if fs.created != nil {
+			if _, zero := fs.created.ValueOf(ctx, rv); zero {
+				if err := fs.created.Set(ctx, rv, actor); err != nil {
+					return err
+				}
+			}
+		}
+		if fs.updated != nil {
+			if err := fs.updated.Set(ctx, rv, actor); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stampUpdated UpdateFull 时赋值 updated_by
+func (r *Repo[T, K]) stampUpdated(db *gorm.DB, t *T) error {
+	actor := r.actor()
+	if actor == "" || t == nil {
+		return nil
+	}
+	fs, err := r.actorFields(db)
+	if err != nil || fs.updated == nil {
+		return err
+	}
+	return fs.updated.Set(r.context(), reflect.ValueOf(t).Elem(), actor)
+}
+
+// stampUpdateSets Update 时向赋值字段追加 updated_by（已显式 Set 时保留）
+func (r *Repo[T, K]) stampUpdateSets(db *gorm.DB, sets map[string]any) error {
+	actor := r.actor()
+	if actor == "" {
+		return nil
+	}
+	fs, err := r.actorFields(db)
+	if err != nil || fs.updated == nil {
+		return err
+	}
+	if _, ok := sets[fs.updated.DBName]; !ok {
+		sets[fs.updated.DBName] = actor
+	}
+	return nil
+}
+
+// deletedByColumn 软删除时需要赋值的 deleted_by 列，不需要时返回空串
+func (r *Repo[T, K]) deletedByColumn(db *gorm.DB) (string, string, error) {
+	actor := r.actor()
+	if actor == "" {
+		return "", "", nil
+	}
+	fs, err := r.actorFields(db)
+	if err != nil || fs.deleted == nil || !fs.softDelete {
+		return "", "", err
+	}
+	return fs.deleted.DBName, actor, nil
+}
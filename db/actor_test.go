@@ -0,0 +1,65 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+type userKey struct{}
+
+type Doc struct {
+	db.ModelAudited[int64]
+	Title string
+}
+
+func (Doc) TableName() string { return "docs" }
+func (Doc) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, ActorFromContext: func(ctx context.Context) string {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user
+	}}
+}
+
+func TestActorStamping(t *testing.T) {
+	cleanTables(t, "docs")
+	alice := context.WithValue(context.Background(), userKey{}, "alice")
+	bob := context.WithValue(context.Background(), userKey{}, "bob")
+	repo := db.NewRepo[Doc, int64]()
+
+	d := &Doc{Title: "a"}
+	id, err := repo.WithCtx(&alice).Create(d)
+	if err != nil || d.CreatedBy != "alice" || d.UpdatedBy != "alice" {
+		t.Fatalf("create stamping failed: %v, %+v", err, d)
+	}
+	batch := []*Doc{{Title: "b"}, {Title: "c"}}
+	if _, err := repo.WithCtx(&alice).CreateBatch(batch); err != nil || batch[1].CreatedBy != "alice" {
+		t.Fatalf("create batch stamping failed: %v, %+v", err, batch[1])
+	}
+
+	if _, err := repo.WithCtx(&bob).Eq("id", id).Set("title", "a2").Update(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repo.GetByID(id)
+	if got.CreatedBy != "alice" || got.UpdatedBy != "bob" {
+		t.Fatalf("update stamping failed: %+v", got)
+	}
+
+	got.Title = "a3"
+	if _, err := repo.WithCtx(&alice).UpdateFull(got); err != nil || got.UpdatedBy != "alice" {
+		t.Fatalf("update full stamping failed: %v, %+v", err, got)
+	}
+
+	if n, err := repo.WithCtx(&bob).In("title", []string{"b", "c"}).Del(); err != nil || n != 2 {
+		t.Fatalf("soft delete failed: %v, %d", err, n)
+	}
+	var deleted []Doc
+	testDB.Unscoped().Where("title IN ?", []string{"b", "c"}).Find(&deleted)
+	if len(deleted) != 2 || deleted[0].DeletedBy != "bob" || !deleted[0].DeletedAt.Valid {
+		t.Fatalf("deleted_by not stamped: %+v", deleted)
+	}
+	if got, _ := repo.GetByID(id); got.DeletedBy != "" {
+		t.Fatalf("other rows should not be stamped: %+v", got)
+	}
+}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+	"gorm.io/gorm"
+)
+
+// region Audit Context
+
+type actorKey struct{}
+type requestIDKey struct{}
+
+// WithActor 返回携带操作人的上下文
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom 从上下文读取操作人
+func ActorFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// WithRequestID 返回携带请求ID的上下文
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom 从上下文读取请求ID
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// endregion Audit Context
+
+// region Audit Sink
+
+// FieldChange 字段变更前后的值
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// AuditEntry 一条实体变更审计记录
+type AuditEntry struct {
+	Table     string                 // 表名
+	EntityID  string                 // 实体主键
+	Action    OpKind                 // OpUpdate / OpUpdateFull / OpDel
+	Actor     string                 // 操作人
+	RequestID string                 // 请求ID
+	Changes   map[string]FieldChange // 按列名的字段变更，删除时 New 为 nil
+	At        time.Time
+}
+
+// AuditSink 审计记录输出，tx 为写操作所在的事务，写入失败时整个写操作回滚
+type AuditSink interface {
+	WriteAudit(tx *gorm.DB, entries []AuditEntry) error
+}
+
+// AuditSinkFunc 函数形式的 AuditSink
+type AuditSinkFunc func(tx *gorm.DB, entries []AuditEntry) error
+
+func (f AuditSinkFunc) WriteAudit(tx *gorm.DB, entries []AuditEntry) error {
+	return f(tx, entries)
+}
+
+// AuditLog audit_log 表结构
+type AuditLog struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Table     string    `gorm:"column:entity_table;size:128;index" json:"table"`
+	EntityID  string    `gorm:"size:64;index" json:"entity_id"`
+	Action    string    `gorm:"size:32" json:"action"`
+	Actor     string    `gorm:"size:128" json:"actor"`
+	RequestID string    `gorm:"size:128" json:"request_id"`
+	Changes   string    `gorm:"type:text" json:"changes"` // JSON: {"列名": {"old": ..., "new": ...}}
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (AuditLog) TableName() string { return "audit_log" }
+
+type tableAuditSink struct{}
+
+// AuditTable 写入 audit_log 表的 AuditSink，表结构随 Repo 自动迁移创建
+func AuditTable() AuditSink {
+	return tableAuditSink{}
+}
+
+func (tableAuditSink) Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&AuditLog{})
+}
+
+func (tableAuditSink) WriteAudit(tx *gorm.DB, entries []AuditEntry) error {
+	logs := make([]AuditLog, len(entries))
+	for i, e := range entries {
+		changes, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+		logs[i] = AuditLog{
+			Table:     e.Table,
+			EntityID:  e.EntityID,
+			Action:    string(e.Action),
+			Actor:     e.Actor,
+			RequestID: e.RequestID,
+			Changes:   string(changes),
+			CreatedAt: e.At,
+		}
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).CreateInBatches(logs, 500).Error
+}
+
+// sinkMigrator 需要随 Repo 自动迁移的 AuditSink
+type sinkMigrator interface {
+	Migrate(db *gorm.DB) error
+}
+
+// endregion Audit Sink
+
+// region Repo Audit
+
+// writeTxNeeded 写操作是否需要与审计、发件箱或变更记录在同一事务中执行（已在写事务流程中的嵌套调用除外）
+func (r *Repo[T, K]) writeTxNeeded() bool {
+	return (r.cfg.Audit != nil || r.recordsWrites()) && !r.writeTx
+}
+
+// recordsWrites 写操作成功后是否需要在同一事务中写入发件箱或变更记录
+func (r *Repo[T, K]) recordsWrites() bool {
+	return r.cfg.Outbox != nil || r.cfg.ChangeLog == CaptureHooks
+}
+
+// auditing 当前写操作是否需要记录审计
+func (r *Repo[T, K]) auditing() bool {
+	return r.cfg.Audit != nil && r.writeTx
+}
+
+// inWriteTx 审计、发件箱、变更记录与写操作在同一事务中执行：已处于事务时直接复用，否则开启事务
+func (r *Repo[T, K]) inWriteTx(run func(*Repo[T, K]) (int64, error)) (int64, error) {
+	db, err := r.conn()
+	if err != nil {
+		return 0, err
+	}
+	c := r.cloneInternal()
+	c.writeTx = true
+	if inTx(db) {
+		return run(c)
+	}
+	var n int64
+	hooks := newTxHooks(db)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		c.db = tx.Session(&gorm.Session{NewDB: true})
+		c.bound = true
+		c.hooks = hooks
+		var runErr error
+		n, runErr = run(c)
+		return runErr
+	})
+	// 写事务的回调由 Repo 内部注册（失效缓存、事件投递），panic 已通过 gorm logger 报告，不影响写操作结果
+	if err != nil {
+		_ = c.runTxHooks(false)
+		return 0, err
+	}
+	_ = c.runTxHooks(true)
+	return n, nil
+}
+
+// auditBefore 以写操作相同的条件加载前像
+func (r *Repo[T, K]) auditBefore(db *gorm.DB) ([]T, error) {
+	if !r.auditing() {
+		return nil, nil
+	}
+	var rows []T
+	err := db.Session(&gorm.Session{}).Find(&rows).Error
+	return rows, err
+}
+
+// auditImages 按主键加载当前行
+func (r *Repo[T, K]) auditImages(ids []K) ([]T, error) {
+	if !r.auditing() || len(ids) == 0 {
+		return nil, nil
+	}
+	db, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+	if r.shardTable != "" {
+		db = db.Table(r.shardTable)
+	}
+	field, values, err := r.keysIn(ids)
+	if err != nil {
+		return nil, err
+	}
+	sql, args := new(clause.Match).In(field, values).WhereSql()
+	var rows []T
+	err = db.Model(new(T)).Where(sql, args...).Find(&rows).Error
+	return rows, err
+}
+
+// auditAfter 加载后像，计算字段差异并写入审计输出
+func (r *Repo[T, K]) auditAfter(action OpKind, before []T) error {
+	if !r.auditing() || len(before) == 0 {
+		return nil
+	}
+	ids := make([]K, len(before))
+	for i := range before {
+		ids[i] = before[i].GetID()
+	}
+	var after []T
+	if action != OpDel {
+		var err error
+		if after, err = r.auditImages(ids); err != nil {
+			return err
+		}
+	}
+	afterByID := make(map[K]*T, len(after))
+	for i := range after {
+		afterByID[after[i].GetID()] = &after[i]
+	}
+
+	db, err := r.conn()
+	if err != nil {
+		return err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	ctx := r.context()
+	table := r.table
+	if r.shardTable != "" {
+		table = r.shardTable
+	}
+	now := time.Now()
+	var entries []AuditEntry
+	for i := range before {
+		id := before[i].GetID()
+		oldRV := reflect.ValueOf(&before[i]).Elem()
+		var newRV reflect.Value
+		if t, ok := afterByID[id]; ok {
+			newRV = reflect.ValueOf(t).Elem()
+		}
+		changes := make(map[string]FieldChange)
+		for _, field := range sch.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			masked, skip := auditValue(sch, field)
+			if skip {
+				continue
+			}
+			oldVal, _ := field.ValueOf(ctx, oldRV)
+			var newVal any
+			if newRV.IsValid() {
+				newVal, _ = field.ValueOf(ctx, newRV)
+			}
+			if reflect.DeepEqual(oldVal, newVal) {
+				continue
+			}
+			if masked {
+				// 加密字段不以明文写入审计
+				oldVal = maskedValue
+				if newRV.IsValid() {
+					newVal = maskedValue
+				}
+			}
+			changes[field.DBName] = FieldChange{Old: oldVal, New: newVal}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		entries = append(entries, AuditEntry{
+			Table:     table,
+			EntityID:  fmt.Sprint(id),
+			Action:    action,
+			Actor:     r.actor(),
+			RequestID: RequestIDFrom(ctx),
+			Changes:   changes,
+			At:        now,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.cfg.Audit.WriteAudit(db, entries)
+}
+
+// endregion Repo Audit
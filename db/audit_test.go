@@ -0,0 +1,81 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"gorm.io/gorm"
+)
+
+type Ledger struct {
+	db.ModelI64
+	Name   string
+	Amount int
+}
+
+func (Ledger) TableName() string { return "ledgers" }
+func (Ledger) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Audit: db.AuditTable()}
+}
+
+func TestAuditTrail(t *testing.T) {
+	cleanTables(t, "ledgers", "audit_log")
+	ctx := db.WithRequestID(db.WithActor(context.Background(), "alice"), "req-1")
+	repo := db.NewRepo[Ledger, int64]().WithCtx(&ctx)
+	id, _ := repo.Create(&Ledger{Name: "a", Amount: 10})
+	_, _ = repo.Create(&Ledger{Name: "b", Amount: 20})
+
+	if _, err := repo.Eq("name", "a").Set("amount", 11).Update(); err != nil {
+		t.Fatal(err)
+	}
+	var logs []db.AuditLog
+	testDB.Where("entity_table = ?", "ledgers").Order("id").Find(&logs)
+	if len(logs) != 1 || logs[0].Actor != "alice" || logs[0].RequestID != "req-1" || logs[0].Action != string(db.OpUpdate) {
+		t.Fatalf("unexpected audit logs: %+v", logs)
+	}
+	var changes map[string]db.FieldChange
+	_ = json.Unmarshal([]byte(logs[0].Changes), &changes)
+	if c, ok := changes["amount"]; !ok || c.Old != float64(10) || c.New != float64(11) {
+		t.Fatalf("unexpected changes: %s", logs[0].Changes)
+	}
+
+	l, _ := repo.GetByID(id)
+	l.Name = "a2"
+	if _, err := repo.Save(l); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Gt("amount", 0).Del(); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	testDB.Model(&db.AuditLog{}).Where("entity_table = ?", "ledgers").Count(&n)
+	if n != 4 {
+		t.Fatalf("expected 4 audit logs (update, update_full, 2 del), got %d", n)
+	}
+}
+
+type FailingLedger struct {
+	db.ModelI64
+	Amount int
+}
+
+func (FailingLedger) TableName() string { return "failing_ledgers" }
+func (FailingLedger) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Audit: db.AuditSinkFunc(func(tx *gorm.DB, entries []db.AuditEntry) error {
+		return errors.New("sink unavailable")
+	})}
+}
+
+func TestAuditRollback(t *testing.T) {
+	repo := db.NewRepo[FailingLedger, int64]()
+	id, _ := repo.Create(&FailingLedger{Amount: 1})
+	if _, err := repo.Eq("id", id).Set("amount", 2).Update(); err == nil {
+		t.Fatalf("expected sink error")
+	}
+	if l, _ := repo.GetByID(id); l.Amount != 1 {
+		t.Fatalf("update should be rolled back with audit failure, got %d", l.Amount)
+	}
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db/ds"
+	"gorm.io/gorm"
+)
+
+// Cache 实体缓存接口，可替换为 Redis 等实现；值为模型值类型 T
+type Cache interface {
+	Get(key string) (any, bool)
+	// Set 写入缓存，ttl<=0 时使用实现的默认过期时间
+	Set(key string, val any, ttl time.Duration)
+	Delete(keys ...string)
+}
+
+// region LRU Cache
+
+// LRUCache 进程内 LRU + TTL 缓存
+type LRUCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List // 最近使用的在前
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	val     any
+	expires time.Time
+}
+
+// NewLRUCache 创建进程内缓存，size 为最大条目数，ttl 为默认过期时间（<=0 表示不过期）
+func NewLRUCache(size int, ttl time.Duration) *LRUCache {
+	if size <= 0 {
+		panic("cache size must be positive")
+	}
+	return &LRUCache{size: size, ttl: ttl, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *LRUCache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.val, true
+}
+
+func (c *LRUCache) Set(key string, val any, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = &lruEntry{key: key, val: val, expires: expires}
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&lruEntry{key: key, val: val, expires: expires})
+	for len(c.entries) > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRUCache) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Len 当前缓存条目数
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// endregion LRU Cache
+
+// region Singleflight
+
+// flightGroup 合并同一 key 的并发加载，防止缓存击穿
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val any
+	err error
+}
+
+func (g *flightGroup) do(key string, fn func() (any, error)) (any, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return c.val, c.err
+}
+
+// endregion Singleflight
+
+// region Repo Entity Cache
+
+func (r *Repo[T, K]) cacheKey(id K) string {
+	return fmt.Sprintf("%s:%v", r.key, normalizeKey(id))
+}
+
+// readCache 本次读操作可用的实体缓存。带附加条件、字段选择、关联加载、租户、Resolver、
+// 生效中的全局作用域或处于事务中时，结果与缓存内容不等价，直接查库；
+// 配置了拦截器时同样直接查库，命中缓存会绕过拦截器（鉴权、改写条件等）
+func (r *Repo[T, K]) readCache() (Cache, bool) {
+	cache := r.cfg.Cache
+	if cache == nil || r.tenantColumn != "" || r.cfg.Resolver != nil || r.raw != nil || len(r.cfg.Interceptors) != 0 {
+		return nil, false
+	}
+	if len(r.match.Clauses) != 0 || len(r.wheres) != 0 || len(r.selects) != 0 || len(r.omits) != 0 ||
+		len(r.preloads) != 0 || len(r.joins) != 0 {
+		return nil, false
+	}
+	if r.hooks != nil || inTx(r.db) {
+		return nil, false
+	}
+	if sql, _ := r.ScopeMatch().WhereSql(); sql != "" {
+		return nil, false
+	}
+	return cache, true
+}
+
+// cachedGet 读穿缓存：未命中时合并并发加载，从主库读取后回填
+func (r *Repo[T, K]) cachedGet(cache Cache, id K) (*T, error) {
+	key := r.cacheKey(id)
+	if v, ok := cache.Get(key); ok {
+		t := v.(T)
+		return &t, nil
+	}
+	v, err := r.flight.do(key, func() (any, error) {
+		gen := r.cacheGen.Load()
+		c, err := r.whereKey(id)
+		if err != nil {
+			return nil, err
+		}
+		c.primary = true
+		t, err := c.Get()
+		if err != nil || t == nil {
+			return t, err
+		}
+		// 加载期间发生过失效时不回填，避免写入旧值
+		if r.cacheGen.Load() == gen {
+			cache.Set(key, *t, 0)
+		}
+		return t, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := v.(*T)
+	if t == nil {
+		return nil, nil
+	}
+	res := *t
+	return &res, nil
+}
+
+// matchedIDs 条件更新或删除前查询命中的 ID，用于失效缓存、领域事件、发件箱与变更记录；均未配置时不查询
+func (r *Repo[T, K]) matchedIDs(db *gorm.DB) ([]K, error) {
+	if r.cfg.Cache == nil && r.cfg.Events == nil && !r.recordsWrites() {
+		return nil, nil
+	}
+	return r.pluckKeys(db)
+}
+
+// invalidate 写操作后失效实体缓存并使查询结果缓存整体过期；
+// 事务中在提交后再次失效，防止提交前被并发读回填旧值
+func (r *Repo[T, K]) invalidate(ids ...K) {
+	cache := r.cfg.Cache
+	var keys []string
+	if cache != nil {
+		for _, id := range ids {
+			keys = append(keys, r.cacheKey(id))
+		}
+	}
+	evict := func() {
+		r.cacheGen.Add(1)
+		if len(keys) != 0 {
+			cache.Delete(keys...)
+		}
+	}
+	evict()
+	if r.hooks != nil {
+		r.hooks.onCommit(evict)
+	}
+}
+
+// endregion Repo Entity Cache
+
+// region Query Result Cache
+
+// queryCache 未配置 RepoCfg.Cache 时查询结果缓存使用的进程内缓存
+var queryCache Cache = NewLRUCache(10000, time.Minute)
+
+// Cached 缓存本次 List/Count/Page 的结果 ttl 时长，该表任意写操作后失效，返回新的 Repo 实例
+func (r *Repo[T, K]) Cached(ttl time.Duration) IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.cacheTTL = ttl
+	return newRepo
+}
+
+// resultCache 本次查询可用的结果缓存，事务中或原生 SQL 不缓存
+func (r *Repo[T, K]) resultCache() (Cache, bool) {
+	if r.cacheTTL <= 0 || r.raw != nil || r.hooks != nil || inTx(r.db) {
+		return nil, false
+	}
+	if r.cfg.Cache != nil {
+		return r.cfg.Cache, true
+	}
+	return queryCache, true
+}
+
+// fingerprint 由表、失效计数、租户、Match（条件、排序、赋值）、字段选择、自定义条件、
+// 生效的全局作用域、关联加载、limit 与分页生成稳定的缓存键
+func (r *Repo[T, K]) fingerprint(op string, gen uint64) string {
+	h := sha256.New()
+	w := func(format string, a ...any) { _, _ = fmt.Fprintf(h, format, a...) }
+	w("%s|%s|%d|%s|%s\n", r.key, r.shardTable, gen, r.source, op)
+	if tenant, ok := ds.TenantFromContext(r.context()); ok && (r.tenantColumn != "" || r.cfg.Resolver != nil) {
+		w("tenant:%s|%t\n", tenant, r.acrossTenants)
+	}
+	for _, c := range r.match.Clauses {
+		w("c:%s|%s|%#v\n", c.Field, c.Op, c.Value)
+	}
+	for _, c := range r.match.Orders {
+		w("o:%s|%s\n", c.Field, c.Op)
+	}
+	for _, c := range r.match.Sets {
+		w("s:%s|%#v\n", c.Field, c.Value)
+	}
+	w("sel:%q|omit:%q\n", r.selects, r.omits)
+	for _, e := range r.wheres {
+		w("w:%s|%#v\n", e.sql, e.args)
+	}
+	scopeSql, scopeArgs := r.ScopeMatch().WhereSql()
+	w("scope:%s|%#v|%s\n", scopeSql, scopeArgs, r.ScopeMatch().OrderSql())
+	for _, p := range r.preloads {
+		m := p.match()
+		sql, args := m.WhereSql()
+		w("p:%s|%s|%#v|%s\n", p.path, sql, args, m.OrderSql())
+	}
+	w("j:%q\n", r.joins)
+	w("limit:%d\n", r.limit)
+	if r.page != nil {
+		w("page:%d|%d\n", r.page.Page, r.page.Size)
+	}
+	return r.key + ":q:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedResult 按指纹读取查询结果，未命中时合并并发加载并回填；clone 用于返回副本，避免调用方修改缓存内容
+func cachedResult[T IModel[K], K Key, V any](r *Repo[T, K], op string, load func(*Repo[T, K]) (V, error), clone func(V) V) (V, error) {
+	cache, ok := r.resultCache()
+	if !ok {
+		// 不缓存时清除 cacheTTL 再加载，否则 load 会再次进入 cachedResult
+		c := r.cloneInternal()
+		c.cacheTTL = 0
+		return load(c)
+	}
+	key := r.fingerprint(op, r.cacheGen.Load())
+	if v, ok := cache.Get(key); ok {
+		return clone(v.(V)), nil
+	}
+	v, err := r.flight.do(key, func() (any, error) {
+		c := r.cloneInternal()
+		c.cacheTTL = 0
+		v, err := load(c)
+		if err != nil {
+			return v, err
+		}
+		// 键中包含加载前的失效计数，加载期间发生写操作时回填的结果不会再被读取
+		cache.Set(key, v, r.cacheTTL)
+		return v, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return clone(v.(V)), nil
+}
+
+// endregion Query Result Cache
@@ -0,0 +1,180 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+var accountCache = db.NewLRUCache(100, time.Minute)
+
+type Account struct {
+	db.ModelI64
+	Name    string
+	Balance int
+}
+
+func (Account) TableName() string { return "accounts" }
+func (Account) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Cache: accountCache}
+}
+
+func TestEntityCache(t *testing.T) {
+	cleanTables(t, "accounts")
+	repo := db.NewRepo[Account, int64]()
+	id, _ := repo.Create(&Account{Name: "a", Balance: 10})
+	id2, _ := repo.Create(&Account{Name: "b", Balance: 20})
+
+	cachedBefore := accountCache.Len()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if a, err := repo.GetByID(id); err != nil || a == nil || a.Name != "a" {
+				t.Errorf("get by id failed: %v, %+v", err, a)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := accountCache.Len() - cachedBefore; n != 1 {
+		t.Fatalf("expected 1 cached entity, got %d", n)
+	}
+
+	// 绕过 Repo 直接修改，缓存仍返回旧值
+	testDB.Exec("UPDATE accounts SET balance = 99 WHERE id = ?", id)
+	if a, _ := repo.GetByID(id); a.Balance != 10 {
+		t.Fatalf("expected cached balance 10, got %d", a.Balance)
+	}
+
+	// 条件更新按命中 ID 失效
+	if _, err := repo.Eq("name", "a").Set("balance", 11).Update(); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := repo.GetByID(id); a.Balance != 11 {
+		t.Fatalf("expected invalidated balance 11, got %d", a.Balance)
+	}
+
+	m, err := repo.GetByIDs([]int64{id, id2, id})
+	if err != nil || len(m) != 2 || m[id2].Name != "b" {
+		t.Fatalf("get by ids failed: %v, %+v", err, m)
+	}
+
+	// 事务中的写操作在提交后失效
+	tx := repo.Begin()
+	a, _ := repo.GetByID(id2)
+	a.Balance = 21
+	if _, err := tx.Save(a); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = repo.GetByID(id2)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := repo.GetByID(id2); a.Balance != 21 {
+		t.Fatalf("expected committed balance 21, got %d", a.Balance)
+	}
+
+	if _, err := repo.Eq("id", id).Del(); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := repo.GetByID(id); a != nil {
+		t.Fatalf("deleted entity should not be cached: %+v", a)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	cleanTables(t, "accounts")
+	repo := db.NewRepo[Account, int64]()
+	_, _ = repo.CreateBatch([]*Account{{Name: "q", Balance: 1}, {Name: "q", Balance: 2}})
+
+	cached := repo.Cached(time.Minute).Eq("name", "q").Asc("balance")
+	list, err := cached.List()
+	if err != nil || len(list) != 2 {
+		t.Fatalf("cached list failed: %v, %+v", err, list)
+	}
+	list[0].Name = "mutated"
+
+	// 绕过 Repo 的修改不可见，且调用方修改结果不影响缓存
+	testDB.Exec("DELETE FROM accounts WHERE name = ?", "q")
+	list, _ = cached.List()
+	if len(list) != 2 || list[0].Name != "q" {
+		t.Fatalf("expected cached result, got %+v", list)
+	}
+	if n, _ := cached.Count(); n != 0 {
+		t.Fatalf("count has its own cache entry, expected 0, got %d", n)
+	}
+	if page, _ := repo.Cached(time.Minute).Eq("name", "q").PageMT(1, 2); page.Total != 0 {
+		t.Fatalf("different page fingerprint expected fresh query, got %+v", page)
+	}
+
+	// 任意写操作使该表的查询结果缓存失效
+	_, _ = repo.Create(&Account{Name: "q", Balance: 3})
+	if list, _ := cached.List(); len(list) != 1 || list[0].Balance != 3 {
+		t.Fatalf("expected invalidated result, got %+v", list)
+	}
+}
+
+type Vault struct {
+	db.ModelI64
+	Secret string
+}
+
+func (Vault) TableName() string { return "vaults" }
+func (Vault) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Cache: db.NewLRUCache(10, time.Minute), Interceptors: []db.Interceptor{
+		func(ctx context.Context, op db.Operation, next func() error) error {
+			if db.ActorFrom(ctx) == "" {
+				return errors.New("actor required")
+			}
+			return next()
+		},
+	}}
+}
+
+func TestCacheWithInterceptors(t *testing.T) {
+	cleanTables(t, "vaults")
+	ctx := db.WithActor(context.Background(), "alice")
+	repo := db.NewRepo[Vault, int64]()
+	id, _ := repo.WithCtx(&ctx).Create(&Vault{Secret: "s"})
+	if v, err := repo.WithCtx(&ctx).GetByID(id); err != nil || v == nil {
+		t.Fatalf("get by id failed: %v, %+v", err, v)
+	}
+
+	// 再次读取不走缓存，仍经过拦截器
+	if _, err := repo.GetByID(id); err == nil || err.Error() != "actor required" {
+		t.Fatalf("cached read should still be intercepted, got %v", err)
+	}
+	if _, err := repo.GetByIDs([]int64{id}); err == nil || err.Error() != "actor required" {
+		t.Fatalf("cached batch read should still be intercepted, got %v", err)
+	}
+}
+
+func TestQueryCacheBypassed(t *testing.T) {
+	cleanTables(t, "accounts")
+	repo := db.NewRepo[Account, int64]()
+	_, _ = repo.Create(&Account{Name: "bypass", Balance: 1})
+
+	// 事务中与原生 SQL 不缓存，直接查询
+	tx := repo.Begin()
+	if n, err := tx.Cached(time.Minute).Eq("name", "bypass").Count(); err != nil || n != 1 {
+		t.Fatalf("cached count in tx failed: %d %v", n, err)
+	}
+	if page, err := tx.Cached(time.Minute).Eq("name", "bypass").PageT(); err != nil || page.Total != 1 {
+		t.Fatalf("cached page in tx failed: %+v %v", page, err)
+	}
+	_ = tx.Rollback()
+	tx = repo.Tx()
+	if list, err := tx.Cached(time.Minute).Eq("name", "bypass").List(); err != nil || len(list) != 1 {
+		t.Fatalf("cached list in tx failed: %+v %v", list, err)
+	}
+	_ = tx.Rollback()
+	list, err := repo.Cached(time.Minute).Raw("SELECT * FROM accounts WHERE name = ?", "bypass").List()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("cached raw list failed: %+v %v", list, err)
+	}
+}
@@ -0,0 +1,435 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+	"gorm.io/gorm"
+	gclause "gorm.io/gorm/clause"
+)
+
+// ChangeCapture 变更捕获方式
+type ChangeCapture int
+
+const (
+	// CaptureOff 不记录变更
+	CaptureOff ChangeCapture = iota
+	// CaptureHooks Repo 写操作在同一事务中写入 change_log，绕过 Repo 的写入（Exec、直接使用 gorm）不会被捕获
+	CaptureHooks
+	// CaptureTriggers 仅 sqlite：迁移时为表安装触发器写入 change_log，任何写入都会被捕获；
+	// 复合主键的字段需为数字或字符串
+	CaptureTriggers
+)
+
+// watchBatch 每次轮询读取的变更数，watchInterval 无新变更时的轮询间隔
+const (
+	watchBatch    = 500
+	watchInterval = 200 * time.Millisecond
+)
+
+// ChangeLog change_log 表结构。ID 为写入时分配的自增ID，并发写入时不一定按提交顺序可见；
+// Pos 为变更位置，由 Watch 在变更提交可见后按可见顺序分配，WatchFrom 按 Pos 续读
+type ChangeLog struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Pos       *int64    `gorm:"uniqueIndex" json:"pos"` // 未分配时为 NULL
+	Table     string    `gorm:"column:entity_table;size:128;index" json:"table"`
+	EntityID  string    `gorm:"size:255" json:"entity_id"`   // JSON 编码的主键
+	Tenant    string    `gorm:"size:64;index" json:"tenant"` // 行级多租户时记录所属租户
+	Op        string    `gorm:"size:16" json:"op"`           // create / update / del
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ChangeLog) TableName() string { return "change_log" }
+
+// Change Watch 推送的一条变更
+type Change[T IModel[K], K Key] struct {
+	ID       int64     // 变更位置（ChangeLog.Pos），消费方保存后可通过 WatchFrom 从此处续读
+	Table    string    // 变更的表名
+	EntityID K         // 变更记录的主键
+	Op       OpKind    // OpCreate / OpUpdate / OpDel
+	Entity   *T        // 读取变更时记录的当前状态，已删除时为 nil
+	At       time.Time // 变更时间
+	Err      error     // 轮询出错时仅设置 Err，Watch 随后继续重试
+}
+
+// changeOp 归并为 create / update / del 三类
+func changeOp(op OpKind) OpKind {
+	switch op {
+	case OpCreate, OpCreateBatch:
+		return OpCreate
+	case OpUpdate, OpUpdateFull:
+		return OpUpdate
+	}
+	return op
+}
+
+// changeTables 变更记录对应的表，分表时为全部分片表
+func (r *Repo[T, K]) changeTables() []string {
+	if r.cfg.Sharding != nil {
+		return r.cfg.Sharding.Strategy.Tables(r.table)
+	}
+	return []string{r.table}
+}
+
+// writeChanges 在写操作所在事务中为每个受影响主键写入一条变更
+func (r *Repo[T, K]) writeChanges(op OpKind, ids []K) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	db, err := r.conn()
+	if err != nil {
+		return err
+	}
+	table := r.table
+	if r.shardTable != "" {
+		table = r.shardTable
+	}
+	tenants, err := r.changeTenants(ids)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	logs := make([]ChangeLog, len(ids))
+	for i, id := range ids {
+		key, err := json.Marshal(id)
+		if err != nil {
+			return err
+		}
+		logs[i] = ChangeLog{Table: table, EntityID: string(key), Tenant: tenants(id), Op: string(changeOp(op)), CreatedAt: now}
+	}
+	return db.Session(&gorm.Session{NewDB: true}).CreateInBatches(logs, 500).Error
+}
+
+// changeTenants 变更记录所属的租户：限定租户时为上下文中的租户；跨租户写入时按主键读取记录的租户列，
+// 硬删除时使用删除前读取的 deletedTenants
+func (r *Repo[T, K]) changeTenants(ids []K) (func(K) string, error) {
+	tenant, scoped, err := r.tenantScope()
+	if err != nil || scoped || r.tenantColumn == "" {
+		return func(K) string { return tenant }, err
+	}
+	tenants := r.deletedTenants
+	if tenants == nil {
+		if tenants, err = r.tenantsOf(ids); err != nil {
+			return nil, err
+		}
+	}
+	return func(id K) string { return tenants[normalizeKey(id)] }, nil
+}
+
+// tenantsOf 按主键读取记录（含软删除）的租户列，键为规范化后的主键
+func (r *Repo[T, K]) tenantsOf(ids []K) (map[K]string, error) {
+	db, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	field := sch.LookUpField(r.tenantColumn)
+	if field == nil {
+		return nil, fmt.Errorf("%s: tenant column %s not found", r.key, r.tenantColumn)
+	}
+	cols, err := r.keyColumns()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{field.DBName}
+	for _, c := range cols {
+		names = append(names, c.column)
+	}
+	size, err := r.idChunkSize()
+	if err != nil {
+		return nil, err
+	}
+	tenants := make(map[K]string, len(ids))
+	for start := 0; start < len(ids); start += size {
+		column, values, err := r.keysIn(ids[start:min(start+size, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		sql, args := clause.NewMatch().In(column, values).WhereSql()
+		q := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(new(T))
+		if r.shardTable != "" {
+			q = q.Table(r.shardTable)
+		}
+		var rows []T
+		if err := q.Select(names).Where(sql, args...).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			v, _ := field.ValueOf(r.context(), reflect.ValueOf(&rows[i]).Elem())
+			tenants[normalizeKey(rows[i].GetID())] = fmt.Sprint(v)
+		}
+	}
+	return tenants, nil
+}
+
+// migrateChangeLog 创建 change_log 表，触发器模式下为各表安装触发器
+func (r *Repo[T, K]) migrateChangeLog(db *gorm.DB) error {
+	if err := db.AutoMigrate(&ChangeLog{}); err != nil {
+		return err
+	}
+	if r.cfg.ChangeLog != CaptureTriggers {
+		return nil
+	}
+	if db.Dialector.Name() != "sqlite" {
+		return fmt.Errorf("%s: change log triggers require sqlite, got %s", r.key, db.Dialector.Name())
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	cols, err := r.keyColumns()
+	if err != nil {
+		return err
+	}
+	key := func(row string) string {
+		if len(cols) == 1 && cols[0].index == nil {
+			return fmt.Sprintf("json_quote(%s.%s)", row, cols[0].column)
+		}
+		kt := reflect.TypeFor[K]()
+		pairs := make([]string, len(cols))
+		for i, c := range cols {
+			pairs[i] = fmt.Sprintf("'%s', %s.%s", kt.FieldByIndex(c.index).Name, row, c.column)
+		}
+		return "json_object(" + strings.Join(pairs, ", ") + ")"
+	}
+	// 软删除模型的 UPDATE 若写入 deleted_at 视为删除
+	updateOp := "'update'"
+	for _, f := range sch.Fields {
+		if f.FieldType == deletedAtType {
+			updateOp = fmt.Sprintf("CASE WHEN NEW.%[1]s IS NOT NULL AND OLD.%[1]s IS NULL THEN 'del' ELSE 'update' END", f.DBName)
+		}
+	}
+	tenant := func(row string) string {
+		if r.tenantColumn == "" {
+			return "''"
+		}
+		return fmt.Sprintf("COALESCE(%s.%s, '')", row, r.tenantColumn)
+	}
+	now := "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+	for _, table := range r.changeTables() {
+		for _, t := range []struct{ event, row, op string }{
+			{"INSERT", "NEW", "'create'"},
+			{"UPDATE", "NEW", updateOp},
+			{"DELETE", "OLD", "'del'"},
+		} {
+			// 重建触发器，使其与当前的 change_log 列保持一致
+			name := fmt.Sprintf("dubhe_cdc_%s_%s", table, strings.ToLower(t.event))
+			if err := db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+			sql := fmt.Sprintf(
+				"CREATE TRIGGER %s AFTER %s ON %s BEGIN "+
+					"INSERT INTO change_log (entity_table, entity_id, tenant, op, created_at) VALUES ('%s', %s, %s, %s, %s); END",
+				name, t.event, table, table, key(t.row), tenant(t.row), t.op, now)
+			if err := db.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// errSequenceConflict 并发的位置分配已处理了同一变更
+var errSequenceConflict = errors.New("change log sequence conflict")
+
+// sequenceChanges 为已提交但未分配位置的变更按ID顺序分配位置 pos = max(当前最大位置+1, id)：
+// 未提交的变更不可见，位置按可见顺序递增，游标按位置续读不会越过晚提交的变更；串行写入时位置与ID相同。
+// 分配在事务中串行进行：先执行写语句取得 sqlite 的写锁（读后升级写锁在并发时直接返回 busy），
+// 再以加锁读取当前最大位置（MySQL 锁住索引末尾，并发的分配在此等待）；仍发生冲突的一方回滚，由下次轮询重试
+func sequenceChanges(db *gorm.DB) error {
+	err := db.Session(&gorm.Session{NewDB: true}).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE change_log SET pos = NULL WHERE 1 = 0").Error; err != nil {
+			return err
+		}
+		var last []int64
+		err := tx.Model(&ChangeLog{}).Clauses(gclause.Locking{Strength: "UPDATE"}).
+			Where("pos IS NOT NULL").Order("pos DESC").Limit(1).Pluck("pos", &last).Error
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		err = tx.Model(&ChangeLog{}).Where("pos IS NULL").Order("id").Limit(watchBatch).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		var pos int64
+		if len(last) != 0 {
+			pos = last[0]
+		}
+		for _, id := range ids {
+			pos = max(pos+1, id)
+			res := tx.Model(&ChangeLog{}).Where("id = ? AND pos IS NULL", id).Update("pos", pos)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errSequenceConflict
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errSequenceConflict) {
+		return nil
+	}
+	return err
+}
+
+// Watch 从当前最新位置开始推送本表的变更，ctx 取消后关闭通道
+func (r *Repo[T, K]) Watch(ctx context.Context) <-chan Change[T, K] {
+	db, err := r.conn()
+	var pos int64
+	if err == nil {
+		db = db.WithContext(ctx)
+		if err = sequenceChanges(db); err == nil {
+			err = db.Model(&ChangeLog{}).Select("COALESCE(MAX(pos), 0)").Scan(&pos).Error
+		}
+	}
+	if err != nil {
+		ch := make(chan Change[T, K], 1)
+		ch <- Change[T, K]{Err: err}
+		close(ch)
+		return ch
+	}
+	return r.WatchFrom(ctx, pos)
+}
+
+// WatchFrom 推送位置大于 after 的变更，用于消费方重启后从上次处理的变更位置续读；ctx 取消后关闭通道。
+// 位置在变更提交可见后才分配（见 sequenceChanges），MySQL 等并发写入时晚提交的变更位置更大，续读不会漏读。
+// 行级多租户时只推送上下文中租户的变更（AcrossTenants 时推送全部）；配置了全局作用域时，
+// 创建与更新只推送作用域内可见的记录，删除后记录已无法按作用域判断，按租户推送
+func (r *Repo[T, K]) WatchFrom(ctx context.Context, after int64) <-chan Change[T, K] {
+	ch := make(chan Change[T, K])
+	c := r.cloneInternal()
+	c.ctx = &ctx
+	go func() {
+		defer close(ch)
+		send := func(change Change[T, K]) bool {
+			select {
+			case ch <- change:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			changes, last, full, err := c.changesAfter(after)
+			if err != nil && !send(Change[T, K]{Err: err}) {
+				return
+			}
+			for _, change := range changes {
+				if !send(change) {
+					return
+				}
+			}
+			// 过滤掉的变更同样推进游标
+			after = max(after, last)
+			if full {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchInterval):
+			}
+		}
+	}()
+	return ch
+}
+
+// changesAfter 分配位置后读取一批变更，过滤其它租户与作用域外的记录，并按主键加载记录的当前状态；
+// last 为本批读到的最大位置（含被过滤的变更），full 表示本批已读满
+func (r *Repo[T, K]) changesAfter(after int64) (changes []Change[T, K], last int64, full bool, err error) {
+	db, err := r.conn()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if err := sequenceChanges(db); err != nil {
+		return nil, 0, false, err
+	}
+	tenant, scoped, err := r.tenantScope()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	q := db.Session(&gorm.Session{NewDB: true}).Where("pos > ? AND entity_table IN ?", after, r.changeTables())
+	if scoped {
+		q = q.Where("tenant = ?", tenant)
+	}
+	var logs []ChangeLog
+	if err := q.Order("pos").Limit(watchBatch).Find(&logs).Error; err != nil || len(logs) == 0 {
+		return nil, 0, false, err
+	}
+	last, full = *logs[len(logs)-1].Pos, len(logs) == watchBatch
+	changes = make([]Change[T, K], len(logs))
+	var ids []K
+	for i, log := range logs {
+		changes[i] = Change[T, K]{ID: *log.Pos, Table: log.Table, Op: OpKind(log.Op), At: log.CreatedAt}
+		if err := json.Unmarshal([]byte(log.EntityID), &changes[i].EntityID); err != nil {
+			return nil, 0, false, fmt.Errorf("%s: change %d: %w", r.key, log.ID, err)
+		}
+		if changes[i].Op != OpDel {
+			ids = append(ids, changes[i].EntityID)
+		}
+	}
+	entities, err := r.Primary().GetByIDs(ids)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	hidden, err := r.hiddenIDs(ids, entities)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	res := changes[:0]
+	for _, change := range changes {
+		if change.Op != OpDel {
+			if _, ok := hidden[normalizeKey(change.EntityID)]; ok {
+				continue
+			}
+			if t, ok := entities[change.EntityID]; ok {
+				entity := *t
+				change.Entity = &entity
+			}
+		}
+		res = append(res, change)
+	}
+	return res, last, full, nil
+}
+
+// hiddenIDs 存在但不在全局作用域内的记录（键为规范化后的主键）；visible 为按作用域读到的记录，
+// 其余 ID 去除作用域后仍能读到的记录对本 Repo 不可见，读不到的视为已删除
+func (r *Repo[T, K]) hiddenIDs(ids []K, visible map[K]*T) (map[K]struct{}, error) {
+	if sql, _ := r.ScopeMatch().WhereSql(); sql == "" {
+		return nil, nil
+	}
+	var rest []K
+	for _, id := range ids {
+		if _, ok := visible[id]; !ok {
+			rest = append(rest, id)
+		}
+	}
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	c := r.cloneInternal()
+	for _, s := range c.scopes {
+		c.skipScopes = append(c.skipScopes, s.Name)
+	}
+	c.primary = true
+	found, err := c.GetByIDs(rest)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[K]struct{}, len(found))
+	for id := range found {
+		hidden[normalizeKey(id)] = struct{}{}
+	}
+	return hidden, nil
+}
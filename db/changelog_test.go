@@ -0,0 +1,203 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"github.com/xiaojiecode/dubhe/db/clause"
+	"github.com/xiaojiecode/dubhe/db/ds"
+)
+
+type Post struct {
+	db.ModelI64
+	Title string
+}
+
+func (Post) TableName() string { return "posts" }
+func (Post) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, ChangeLog: db.CaptureHooks}
+}
+
+type Ticket struct {
+	db.ModelI64
+	Title string
+}
+
+func (Ticket) TableName() string { return "tickets" }
+func (Ticket) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, ChangeLog: db.CaptureTriggers}
+}
+
+type Memo struct {
+	db.ModelI64
+	TenantID string
+	Text     string
+	Hidden   bool
+}
+
+func (Memo) TableName() string { return "memos" }
+func (Memo) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, ChangeLog: db.CaptureHooks, TenantColumn: "tenant_id",
+		Scopes: []db.Scope{{Name: "visible", Apply: func(m *clause.Match, _ context.Context) { m.Eq("hidden", false) }}}}
+}
+
+func receive[T db.IModel[K], K db.ID](t *testing.T, ch <-chan db.Change[T, K], n int) []db.Change[T, K] {
+	t.Helper()
+	var res []db.Change[T, K]
+	for len(res) < n {
+		select {
+		case c := <-ch:
+			if c.Err != nil {
+				t.Fatalf("watch failed: %v", c.Err)
+			}
+			res = append(res, c)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %d changes, got %d", n, len(res))
+		}
+	}
+	return res
+}
+
+func TestChangeLog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := db.NewRepo[Post, int64]()
+	if _, err := repo.Create(&Post{Title: "before watch"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	ch := repo.Watch(ctx)
+
+	id, err := repo.Create(&Post{Title: "draft"})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := repo.Eq("id", id).Set("title", "published").Update(); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	tx := repo.Begin()
+	if _, err := tx.Eq("id", id).Set("title", "rolled back").Update(); err != nil {
+		t.Fatalf("update in tx failed: %v", err)
+	}
+	_ = tx.Rollback()
+	if _, err := repo.Eq("id", id).Del(); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+
+	changes := receive(t, ch, 3)
+	if changes[0].Op != db.OpCreate || changes[1].Op != db.OpUpdate || changes[2].Op != db.OpDel {
+		t.Fatalf("unexpected ops: %+v", changes)
+	}
+	for _, c := range changes {
+		if c.EntityID != id || c.Table != "posts" || c.Entity != nil {
+			t.Fatalf("unexpected change, deleted post should have no entity: %+v", c)
+		}
+	}
+	select {
+	case c := <-ch:
+		t.Fatalf("rolled back update should not be recorded: %+v", c)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// 从已处理的位置续读
+	resumed := receive(t, repo.WatchFrom(ctx, changes[0].ID), 2)
+	if resumed[0].ID != changes[1].ID || resumed[1].ID != changes[2].ID {
+		t.Fatalf("resume should start after the given position: %+v", resumed)
+	}
+
+	// 触发器模式捕获绕过 Repo 的写入
+	tickets := db.NewRepo[Ticket, int64]()
+	tch := tickets.Watch(ctx)
+	if _, err := tickets.Exec("INSERT INTO tickets (title, created_at, updated_at) VALUES (?, ?, ?)", "raw", time.Now(), time.Now()); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	got := receive(t, tch, 1)[0]
+	if got.Op != db.OpCreate || got.Entity == nil || got.Entity.Title != "raw" || got.EntityID != got.Entity.ID {
+		t.Fatalf("unexpected trigger change: %+v", got)
+	}
+	if _, err := tickets.Eq("id", got.EntityID).Del(); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+	if got := receive(t, tch, 1)[0]; got.Op != db.OpDel || got.Entity != nil {
+		t.Fatalf("soft delete should be captured as del: %+v", got)
+	}
+}
+
+func TestChangeLogLateCommit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := db.NewRepo[Post, int64]()
+	id, _ := repo.Create(&Post{Title: "late"})
+	ch := repo.Watch(ctx)
+
+	var maxID int64
+	if err := testDB.Model(&db.ChangeLog{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+		t.Fatalf("max id failed: %v", err)
+	}
+	// 模拟并发写入：较大的ID先提交，较小的ID晚提交
+	insert := func(changeID int64) {
+		err := testDB.Exec("INSERT INTO change_log (id, entity_table, entity_id, tenant, op, created_at) VALUES (?, 'posts', ?, '', 'update', ?)",
+			changeID, fmt.Sprint(id), time.Now()).Error
+		if err != nil {
+			t.Fatalf("insert change failed: %v", err)
+		}
+	}
+	insert(maxID + 10)
+	first := receive(t, ch, 1)[0]
+	if first.ID != maxID+10 {
+		t.Fatalf("serialized change position should equal its id: %+v", first)
+	}
+	insert(maxID + 5)
+	late := receive(t, ch, 1)[0]
+	if late.ID <= first.ID || late.EntityID != id || late.Entity == nil {
+		t.Fatalf("late committed change should get a later position: %+v", late)
+	}
+
+	// 游标已越过较小的ID，续读仍能读到晚提交的变更
+	if resumed := receive(t, repo.WatchFrom(ctx, first.ID), 1)[0]; resumed.ID != late.ID {
+		t.Fatalf("resume should include the late change: %+v", resumed)
+	}
+}
+
+func TestChangeLogTenantScope(t *testing.T) {
+	cleanTables(t, "memos")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := db.NewRepo[Memo, int64]()
+	ctxA := ds.WithTenant(ctx, "memo_a")
+	ctxB := ds.WithTenant(ctx, "memo_b")
+	cha := repo.WithCtx(&ctxA).Watch(ctxA)
+	chb := repo.WithCtx(&ctxB).Watch(ctxB)
+
+	if _, err := repo.WithCtx(&ctxB).Create(&Memo{Text: "b"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := repo.WithCtx(&ctxA).Create(&Memo{Text: "hidden", Hidden: true}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	idA, _ := repo.WithCtx(&ctxA).Create(&Memo{Text: "a"})
+
+	// 只推送本租户作用域内的变更
+	if got := receive(t, cha, 1)[0]; got.EntityID != idA || got.Entity == nil || got.Entity.Text != "a" {
+		t.Fatalf("watcher should only see its tenant's visible memos: %+v", got)
+	}
+	got := receive(t, chb, 1)[0]
+	if got.Entity == nil || got.Entity.Text != "b" {
+		t.Fatalf("unexpected change for tenant b: %+v", got)
+	}
+
+	// 跨租户删除按记录所属租户推送
+	if _, err := repo.AcrossTenants().Eq("text", "b").Del(); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+	if del := receive(t, chb, 1)[0]; del.Op != db.OpDel || del.EntityID != got.EntityID {
+		t.Fatalf("tenant b should see the delete: %+v", del)
+	}
+	select {
+	case c := <-cha:
+		t.Fatalf("tenant a should not see other tenants' changes: %+v", c)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
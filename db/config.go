@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -16,17 +17,52 @@ type RepoCfg struct {
 	DataSource  string   // 指定数据源名
 	DB          *gorm.DB // 指定 DB 实例（优先级高于 DataSource）
 	AutoMigrate bool     // 是否自动迁移表结构（默认启用）
+	// Resolver 按操作上下文解析连接（如按租户分库），设置后优先于 DB/DataSource，
+	// 解析出的新连接会按 AutoMigrate 规则自动迁移一次
+	Resolver ds.Resolver
+	// TenantColumn 共享表多租户的租户列，设置后读、改、删自动追加上下文中的租户条件，
+	// 新增自动赋值租户列，上下文缺少租户时拒绝执行；也可由模型实现 TenantScoped 指定
+	TenantColumn string
+	// Scopes 全局作用域，查询、Update、Del 自动应用，可通过 WithoutScope 按名称排除；
+	// 也可由模型实现 Scoped 声明
+	Scopes []Scope
+	// Sharding 水平分表配置，按分片键条件路由到分片表，无法路由的查询扇出到全部分片
+	Sharding *Sharding
+	// Cache 实体缓存，GetByID/GetByIDs 读穿缓存，Save/UpdateFull/Update/Del 自动失效
+	Cache Cache
+	// Interceptors 拦截器链，包裹 Create/CreateBatch/Save/Update/UpdateFull/Del/Get/List/Page，
+	// 第一个在最外层
+	Interceptors []Interceptor
+	// Audit 审计输出（如 db.AuditTable()），设置后 Update/UpdateFull/Save/Del 在同一事务中
+	// 记录受影响行的字段级变更，操作人取自 ActorFromContext，请求ID取自 WithRequestID
+	Audit AuditSink
+	// ActorFromContext 从上下文获取操作人，用于审计与 created_by/updated_by/deleted_by 赋值，
+	// 未设置时读取 WithActor 写入的操作人
+	ActorFromContext func(ctx context.Context) string
+	// IDGenerator 主键生成器，类型须为 IDGenerator[K]（如 db.NewSnowflake(1)、db.UUIDv7()、db.ULID()），
+	// Create/CreateBatch/Save 新增时为零值主键赋值
+	IDGenerator any
+	// Events 领域事件分发器，Create/CreateBatch/Save/Update/UpdateFull/Del 成功后按订阅投递 Event[T, K]
+	Events *Dispatcher
+	// Outbox 发件箱，设置后按 Record 声明的 topic 将写操作事件在同一事务中写入 outbox 表，
+	// 由 Relay 投递；outbox 表随 Repo 自动迁移创建
+	Outbox *Outbox
+	// ChangeLog 变更捕获方式，开启后写入 change_log 表，可通过 Watch/WatchFrom 订阅本表变更
+	ChangeLog ChangeCapture
+	// Encryption 字段加密密钥，设置后 `dubhe:"encrypt"` 字段写入时以 AES-GCM 加密、读取时解密；
+	// 模型存在 <列名>_bidx 列时写入盲索引，加密字段上的 Eq/NEq/In 条件改写为盲索引匹配
+	Encryption KeyProvider
 }
 
 // RepoDefine 接口用于模型绑定 Repo 配置
-type RepoDefine[K ID] interface {
+type RepoDefine[K Key] interface {
 	RepoDefine() RepoCfg
 	TableName() string
 	IModel[K]
 }
 
 // NewRepo 创建并初始化一个通用 Repo
-func NewRepo[T RepoDefine[K], K ID](g ...*gorm.DB) IRepo[T, K] {
+func NewRepo[T RepoDefine[K], K Key](g ...*gorm.DB) IRepo[T, K] {
 	// 获取模型信息
 	model := *new(T)
 	tableName := model.TableName()
@@ -37,23 +73,23 @@ func NewRepo[T RepoDefine[K], K ID](g ...*gorm.DB) IRepo[T, K] {
 		panic("table name is empty")
 	}
 
-	// 获取数据库实例
+	// 获取数据库实例，配置了 Resolver 时连接在每次操作时按上下文解析
+	lazy := cfg.Resolver != nil && len(g) == 0
 	var db *gorm.DB
-	if len(g) != 0 {
-		db = g[0]
+	if lazy {
+		db = cfg.DB
 	} else {
-		switch {
-		case cfg.DB != nil:
-			db = cfg.DB
-		case cfg.DataSource != "":
-			db = ds.MustGetDB(cfg.DataSource)
-		default:
-			db = ds.MustGetDB()
+		db = resolveDB(cfg, g...)
+		if db == nil {
+			panic(fmt.Sprintf("cannot init Repo: db is nil"))
 		}
 	}
-
-	if db == nil {
-		panic(fmt.Sprintf("cannot init Repo: db is nil"))
+	// 通过数据源获取的连接才参与读写分离与结构差异检测
+	source := ""
+	if !lazy && len(g) == 0 && cfg.DB == nil {
+		source = dataSourceName(cfg)
+		// 登记到数据源，供 ds.Diff 做结构差异检测
+		ds.RegisterModel(source, model)
 	}
 	// 构造缓存键（数据源 + 表名）
 	key := tableName
@@ -67,29 +103,83 @@ func NewRepo[T RepoDefine[K], K ID](g ...*gorm.DB) IRepo[T, K] {
 	if cached, ok := templates.Load(key); ok {
 		return &Repo[T, K]{
 			db:           db,
+			bound:        len(g) != 0,
+			source:       source,
 			RepoTemplate: cached.(*RepoTemplate[T, K]),
 		}
 	}
 
-	// 自动迁移表结构（默认开启）
-	if cfg.AutoMigrate || cfg.DB == nil {
-		if err := db.AutoMigrate(model); err != nil {
+	// 创建新的 RepoTemplate
+	autoMigrate := cfg.AutoMigrate || cfg.DB == nil
+	template := &RepoTemplate[T, K]{
+		table:        tableName,
+		model:        &model,
+		key:          key,
+		cfg:          &cfg,
+		autoMigrate:  autoMigrate,
+		tenantColumn: tenantColumnOf(model, cfg),
+		scopes:       scopesOf(model, cfg),
+		idGen:        idGeneratorOf[K](key, cfg),
+	}
+	repo := &Repo[T, K]{
+		db:           db,
+		bound:        len(g) != 0,
+		source:       source,
+		RepoTemplate: template,
+	}
+	// Resolver 解析出的连接按实例记录迁移状态，数据源注销（如租户连接池被淘汰）时一并移除
+	if cfg.Resolver != nil {
+		ds.OnClose(func(_ string, db *gorm.DB) { template.forgetMigrated(db) })
+	}
+
+	// 自动迁移表结构（默认开启），迁移成功后再缓存模板
+	if autoMigrate && !lazy {
+		if err := repo.migrate(db); err != nil {
 			panic(err)
 		}
 	}
+	templates.Store(key, template)
 
-	// 创建并缓存新的 RepoTemplate
-	template := &RepoTemplate[T, K]{
-		ctx:   nil,
-		table: tableName,
-		model: &model,
-		key:   key,
-		cfg:   &cfg,
+	return repo
+}
+
+// resolveDB 按优先级获取数据库实例：显式传入 > RepoCfg.DB > RepoCfg.DataSource > 默认数据源
+func resolveDB(cfg RepoCfg, g ...*gorm.DB) *gorm.DB {
+	if len(g) != 0 {
+		return g[0]
 	}
-	templates.Store(key, template)
+	switch {
+	case cfg.DB != nil:
+		return cfg.DB
+	case cfg.DataSource != "":
+		return ds.MustGetDB(cfg.DataSource)
+	default:
+		return ds.MustGetDB()
+	}
+}
 
-	return &Repo[T, K]{
-		db:           db,
-		RepoTemplate: template,
+// dataSourceName 模型所属的数据源名称，未指定时为 ds.MustGetDB() 解析到的唯一数据源
+func dataSourceName(cfg RepoCfg) string {
+	if cfg.DataSource != "" {
+		return cfg.DataSource
+	}
+	if name, err := ds.DefaultName(); err == nil {
+		return name
+	}
+	return ds.Default
+}
+
+// SchemaDiff 对比模型 T 与实际表结构，返回 AutoMigrate 将执行的迁移计划（不执行任何 DDL）
+func SchemaDiff[T RepoDefine[K], K Key](g ...*gorm.DB) (*ds.SchemaPlan, error) {
+	model := *new(T)
+	cfg := model.RepoDefine()
+	db := resolveDB(cfg, g...)
+	plan, err := ds.DiffModels(db, model)
+	if err != nil {
+		return nil, err
+	}
+	if len(g) == 0 && cfg.DB == nil {
+		plan.DataSource = dataSourceName(cfg)
 	}
+	return plan, nil
 }
@@ -0,0 +1,36 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+type Article struct {
+	db.ModelI64
+	Title string `gorm:"type:varchar(128);not null"`
+}
+
+func (Article) TableName() string { return "articles" }
+func (Article) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB}
+}
+
+func TestSchemaDiff(t *testing.T) {
+	plan, err := db.SchemaDiff[Article, int64]()
+	if err != nil {
+		t.Fatalf("schema diff failed: %v", err)
+	}
+	if !plan.HasChanges() || len(plan.Statements()) == 0 {
+		t.Fatalf("expected create table plan, got %+v", plan)
+	}
+	if testDB.Migrator().HasTable(&Article{}) {
+		t.Fatal("schema diff must not execute ddl")
+	}
+
+	// 已迁移的模型不应有差异
+	plan, err = db.SchemaDiff[User, int64]()
+	if err != nil || plan.HasChanges() {
+		t.Fatalf("expected no changes: %v, %+v", err, plan)
+	}
+}
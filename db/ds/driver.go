@@ -0,0 +1,53 @@
+package ds
+
+import (
+	"sort"
+	"sync"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// DriverFunc 根据 DSN 创建对应数据库的 gorm.Dialector
+type DriverFunc func(dsn string) gorm.Dialector
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]DriverFunc) // key为驱动名称，即 DBConfig.Driver
+)
+
+func init() {
+	RegisterDriver("mysql", mysql.Open)
+}
+
+// RegisterDriver 注册数据库驱动，同名驱动会被覆盖，例如：
+//
+//	ds.RegisterDriver("postgres", postgres.Open)
+//	ds.RegisterDriver("sqlite", glebarez.Open) // 使用纯 Go 的 sqlite 替换内置 cgo 实现
+func RegisterDriver(name string, open DriverFunc) {
+	if open == nil {
+		panic("driver open func can not be nil: " + name)
+	}
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[name] = open
+}
+
+// Drivers 返回已注册的驱动名称
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupDriver(name string) (DriverFunc, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	open, ok := drivers[name]
+	return open, ok
+}
@@ -0,0 +1,11 @@
+//go:build cgo
+
+package ds
+
+import "gorm.io/driver/sqlite"
+
+// 内置的 sqlite 驱动依赖 cgo；CGO_ENABLED=0 构建静态二进制时不会链接，
+// 需要时可通过 RegisterDriver("sqlite", ...) 注册纯 Go 实现
+func init() {
+	RegisterDriver("sqlite", sqlite.Open)
+}
@@ -0,0 +1,36 @@
+package ds
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestBuiltinDrivers(t *testing.T) {
+	assert.Subset(t, Drivers(), []string{"mysql", "sqlite"})
+}
+
+func TestRegisterDriver(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	var opened []string
+	RegisterDriver("sqlite-test", func(dsn string) gorm.Dialector {
+		opened = append(opened, dsn)
+		return sqlite.Open(dsn)
+	})
+	assert.Contains(t, Drivers(), "sqlite-test")
+
+	dsn := filepath.Join(t.TempDir(), "custom.db")
+	err := RegisterDataSource("custom", DBConfig{DSN: dsn, Driver: "sqlite-test", LogLevel: logger.Silent})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dsn}, opened)
+
+	err = RegisterDataSource("unknown", DBConfig{DSN: dsn, Driver: "oracle"})
+	assert.ErrorContains(t, err, "unsupported driver")
+
+	assert.Panics(t, func() { RegisterDriver("nil", nil) })
+}
@@ -6,9 +6,6 @@ import (
 	"sync"
 	"time"
 
-	"gorm.io/driver/sqlite"
-
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -23,7 +20,7 @@ var (
 type DBConfig struct {
 	// 基础连接配置
 	DSN    string // 数据源名称（MySQL的连接串）
-	Driver string // 数据库驱动，如 "mysql", "postgres", "sqlite" 等
+	Driver string // 数据库驱动名称，内置 "mysql"、"sqlite"，其他驱动通过 RegisterDriver 注册
 
 	// GORM日志配置
 	LogLevel logger.LogLevel // gorm日志级别
@@ -34,6 +31,10 @@ type DBConfig struct {
 	ConnMaxLifetime time.Duration // 连接最大生命周期
 	ConnMaxIdleTime time.Duration // 连接最大空闲时间
 
+	// 读写分离配置
+	Replicas []string // 从库DSN列表，读操作路由到从库，写操作与事务使用主库
+	Policy   Policy   // 从库负载均衡策略，为空时使用轮询
+
 	// 其他配置字段可以扩展
 }
 
@@ -46,27 +47,48 @@ func RegisterDataSource(name string, cfg DBConfig) error {
 		return errors.New("data source already exists: " + name)
 	}
 
-	var dialector gorm.Dialector
-	switch cfg.Driver {
-	case "mysql":
-		dialector = mysql.Open(cfg.DSN)
-	case "sqlite":
-		dialector = sqlite.Open(cfg.DSN)
-	// 其他数据库可扩展
-	default:
-		return errors.New("unsupported driver: " + cfg.Driver)
+	db, err := openDB(cfg, cfg.DSN)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Replicas) > 0 {
+		set := &replicaSet{policy: cfg.Policy}
+		if set.policy == nil {
+			set.policy = RoundRobinPolicy()
+		}
+		for _, dsn := range cfg.Replicas {
+			replica, err := openDB(cfg, dsn)
+			if err != nil {
+				closeDBs(append(set.dbs, db)...)
+				return err
+			}
+			set.dbs = append(set.dbs, replica)
+		}
+		replicaMap[name] = set
 	}
 
-	db, err := gorm.Open(dialector, &gorm.Config{
+	dbMap[name] = db
+	return nil
+}
+
+// openDB 按配置打开连接并设置连接池参数，主库与从库共用
+func openDB(cfg DBConfig, dsn string) (*gorm.DB, error) {
+	open, ok := lookupDriver(cfg.Driver)
+	if !ok {
+		return nil, errors.New("unsupported driver: " + cfg.Driver)
+	}
+
+	db, err := gorm.Open(open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(cfg.LogLevel),
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 设置连接池参数
@@ -82,9 +104,17 @@ func RegisterDataSource(name string, cfg DBConfig) error {
 	if cfg.ConnMaxIdleTime > 0 {
 		sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	}
+	wrapSwapPool(db, sqlDB)
+	return db, nil
+}
 
-	dbMap[name] = db
-	return nil
+// closeDBs 尽力关闭一组连接，忽略错误，用于注册失败时的清理
+func closeDBs(dbs ...*gorm.DB) {
+	for _, db := range dbs {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}
 }
 
 // RegisterGorm 直接注册一个已有的 *gorm.DB
@@ -108,24 +138,38 @@ func RegisterGorm(name string, db *gorm.DB) error {
 func GetDB(names ...string) (*gorm.DB, error) {
 	mu.RLock()
 	defer mu.RUnlock()
+	_, db, err := lookup(names...)
+	return db, err
+}
+
+// DefaultName 未指定名称时 GetDB 使用的数据源名称，即唯一注册的数据源的名称
+func DefaultName() (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	name, _, err := lookup()
+	return name, err
+}
+
+// lookup 按 GetDB 的规则查找数据源，调用方需持有读锁
+func lookup(names ...string) (string, *gorm.DB, error) {
 	if len(dbMap) == 0 {
-		return nil, errors.New("no data sources registered")
+		return "", nil, errors.New("no data sources registered")
 	}
 	if len(names) == 0 {
 		if len(dbMap) == 1 {
-			for _, db := range dbMap {
-				return db, nil
+			for name, db := range dbMap {
+				return name, db, nil
 			}
 		}
-		return nil, errors.New("multiple data sources exist, must specify a name")
+		return "", nil, errors.New("multiple data sources exist, must specify a name")
 	}
 
 	name := names[0]
 	db, exists := dbMap[name]
 	if !exists {
-		return nil, fmt.Errorf("data source not found: %s", name)
+		return "", nil, fmt.Errorf("data source not found: %s", name)
 	}
-	return db, nil
+	return name, db, nil
 }
 
 // MustGetDB 获取数据源连接，找不到时直接panic，适合初始化阶段使用
@@ -137,21 +181,17 @@ func MustGetDB(names ...string) *gorm.DB {
 	return db
 }
 
-// CloseAll 关闭所有数据源连接
+// CloseAll 关闭所有数据源连接，单个连接关闭失败不影响其余连接，错误通过 errors.Join 汇总
 func CloseAll() error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	for name, db := range dbMap {
-		sqlDB, err := db.DB()
-		if err != nil {
-			return err
-		}
-		err = sqlDB.Close()
-		if err != nil {
-			return err
-		}
-		delete(dbMap, name)
+	var errs []error
+	for name := range dbMap {
+		errs = append(errs, closeSource(name))
 	}
-	return nil
+	for name := range replicaMap {
+		errs = append(errs, closeSource(name))
+	}
+	return errors.Join(errs...)
 }
@@ -96,6 +96,23 @@ func TestGetDBErrors(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDefaultName(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	_, err := DefaultName()
+	assert.Error(t, err)
+
+	// 唯一数据源不论名称都作为默认数据源
+	_ = RegisterGorm("main", setupTestDB(t))
+	name, err := DefaultName()
+	assert.NoError(t, err)
+	assert.Equal(t, "main", name)
+
+	_ = RegisterGorm("other", setupTestDB(t))
+	_, err = DefaultName()
+	assert.Error(t, err)
+}
+
 func TestCloseAll(t *testing.T) {
 	_ = RegisterGorm("db1", setupTestDB(t))
 	_ = RegisterGorm("db2", setupTestDB(t))
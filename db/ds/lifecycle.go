@@ -0,0 +1,209 @@
+package ds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Health 单个数据源（或从库）的健康状态与连接池统计
+type Health struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Error    string        `json:"error,omitempty"`
+	Latency  time.Duration `json:"latency"`
+	Stats    sql.DBStats   `json:"stats"`
+	Replicas []Health      `json:"replicas,omitempty"`
+}
+
+// closeHooks 数据源主库实例被移除后的回调，受 mu 保护
+var closeHooks []func(name string, db *gorm.DB)
+
+// OnClose 注册数据源主库实例被移除后的回调：Unregister、CloseAll 以及 Replace 替换实例时以被移除的实例调用，
+// 用于清理按 *gorm.DB 记录的状态；回调在持有注册表锁时执行，不能再调用本包的注册与查询函数
+func OnClose(fn func(name string, db *gorm.DB)) {
+	mu.Lock()
+	defer mu.Unlock()
+	closeHooks = append(closeHooks, fn)
+}
+
+func runCloseHooks(name string, db *gorm.DB) {
+	for _, fn := range closeHooks {
+		fn(name, db)
+	}
+}
+
+// Unregister 注销并关闭指定数据源（包括其从库）
+func Unregister(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := dbMap[name]; !exists {
+		return fmt.Errorf("data source not found: %s", name)
+	}
+	return closeSource(name)
+}
+
+// Replace 使用新配置替换已注册的数据源，常用于凭证轮换。
+// 由 RegisterDataSource 注册且驱动不变时，原 *gorm.DB 的底层连接池会被原子替换，
+// 已创建的 Repo 无需重建；旧连接池在进行中的查询结束后关闭。
+// 其余情况（RegisterGorm 注册或更换驱动）直接替换注册表中的实例，之前获取的旧实例将不可用。
+func Replace(name string, cfg DBConfig) error {
+	db, err := openDB(cfg, cfg.DSN)
+	if err != nil {
+		return err
+	}
+	var set *replicaSet
+	if len(cfg.Replicas) > 0 {
+		set = &replicaSet{policy: cfg.Policy}
+		if set.policy == nil {
+			set.policy = RoundRobinPolicy()
+		}
+		for _, dsn := range cfg.Replicas {
+			replica, err := openDB(cfg, dsn)
+			if err != nil {
+				closeDBs(append(set.dbs, db)...)
+				return err
+			}
+			set.dbs = append(set.dbs, replica)
+		}
+	}
+
+	mu.Lock()
+	old, exists := dbMap[name]
+	if !exists {
+		mu.Unlock()
+		closeDBs(db)
+		if set != nil {
+			closeDBs(set.dbs...)
+		}
+		return fmt.Errorf("data source not found: %s", name)
+	}
+
+	var retired []*sql.DB
+	oldPool, swappable := old.ConnPool.(*swapPool)
+	if swappable && old.Dialector.Name() == db.Dialector.Name() {
+		newSQLDB, _ := db.DB()
+		retired = append(retired, oldPool.swap(newSQLDB))
+	} else {
+		dbMap[name] = db
+		if sqlDB, err := old.DB(); err == nil {
+			retired = append(retired, sqlDB)
+		}
+		runCloseHooks(name, old)
+	}
+	if oldSet, ok := replicaMap[name]; ok {
+		for _, r := range oldSet.dbs {
+			if sqlDB, err := r.DB(); err == nil {
+				retired = append(retired, sqlDB)
+			}
+		}
+	}
+	if set != nil {
+		replicaMap[name] = set
+	} else {
+		delete(replicaMap, name)
+	}
+	mu.Unlock()
+
+	// sql.DB.Close 会等待已开始的查询结束
+	var errs []error
+	for _, sqlDB := range retired {
+		errs = append(errs, sqlDB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Ping 检查指定数据源主库连通性
+func Ping(ctx context.Context, name string) error {
+	db, err := GetDB(name)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// HealthCheck 检查所有数据源（含从库）的连通性，返回每个数据源的状态与连接池统计
+func HealthCheck(ctx context.Context) map[string]Health {
+	mu.RLock()
+	names := make([]string, 0, len(dbMap))
+	primaries := make(map[string]*gorm.DB, len(dbMap))
+	replicas := make(map[string][]*gorm.DB)
+	for name, db := range dbMap {
+		names = append(names, name)
+		primaries[name] = db
+		if set, ok := replicaMap[name]; ok {
+			replicas[name] = append([]*gorm.DB(nil), set.dbs...)
+		}
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+
+	res := make(map[string]Health, len(names))
+	for _, name := range names {
+		h := checkHealth(ctx, name, primaries[name])
+		for i, r := range replicas[name] {
+			rh := checkHealth(ctx, fmt.Sprintf("%s#replica%d", name, i), r)
+			h.Replicas = append(h.Replicas, rh)
+		}
+		res[name] = h
+	}
+	return res
+}
+
+func checkHealth(ctx context.Context, name string, db *gorm.DB) Health {
+	h := Health{Name: name}
+	sqlDB, err := db.DB()
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	h.Latency = time.Since(start)
+	h.Stats = sqlDB.Stats()
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Healthy = true
+	return h
+}
+
+// closeSource 关闭并移除指定数据源及其从库，调用方需持有写锁
+func closeSource(name string) error {
+	var errs []error
+	if db, ok := dbMap[name]; ok {
+		if err := closeDB(db); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		delete(dbMap, name)
+		runCloseHooks(name, db)
+	}
+	if set, ok := replicaMap[name]; ok {
+		for i, db := range set.dbs {
+			if err := closeDB(db); err != nil {
+				errs = append(errs, fmt.Errorf("%s#replica%d: %w", name, i, err))
+			}
+		}
+		delete(replicaMap, name)
+	}
+	delete(models, name)
+	return errors.Join(errs...)
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,116 @@
+package ds
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func fileConfig(path string) DBConfig {
+	return DBConfig{DSN: path, Driver: "sqlite", LogLevel: logger.Silent}
+}
+
+func TestUnregister(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	assert.NoError(t, RegisterGorm("one", setupTestDB(t)))
+	assert.NoError(t, RegisterGorm("two", setupTestDB(t)))
+
+	assert.NoError(t, Unregister("one"))
+	_, err := GetDB("one")
+	assert.Error(t, err)
+	_, err = GetDB("two")
+	assert.NoError(t, err)
+
+	assert.Error(t, Unregister("one"))
+}
+
+func TestOnClose(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	var closed []*gorm.DB
+	OnClose(func(name string, db *gorm.DB) {
+		if name == "hooked" {
+			closed = append(closed, db)
+		}
+	})
+	db := setupTestDB(t)
+	assert.NoError(t, RegisterGorm("hooked", db))
+	assert.NoError(t, Unregister("hooked"))
+	assert.Equal(t, []*gorm.DB{db}, closed)
+}
+
+func TestReplace(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	dir := t.TempDir()
+	assert.NoError(t, RegisterDataSource("rotate", fileConfig(filepath.Join(dir, "old.db"))))
+	held := MustGetDB("rotate")
+	assert.NoError(t, held.Exec("CREATE TABLE marker (v text)").Error)
+	assert.NoError(t, held.Exec("INSERT INTO marker VALUES ('old')").Error)
+
+	next := fileConfig(filepath.Join(dir, "new.db"))
+	next.Replicas = []string{filepath.Join(dir, "replica.db")}
+	assert.NoError(t, Replace("rotate", next))
+
+	// 之前持有的实例透明切换到新连接
+	assert.Same(t, held, MustGetDB("rotate"))
+	assert.False(t, held.Migrator().HasTable("marker"))
+	assert.Len(t, Replicas("rotate"), 1)
+
+	assert.Error(t, Replace("missing", next))
+}
+
+func TestReplaceGorm(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	old := setupTestDB(t)
+	assert.NoError(t, RegisterGorm("gorm", old))
+	assert.NoError(t, Replace("gorm", fileConfig(filepath.Join(t.TempDir(), "gorm.db"))))
+	assert.NotSame(t, old, MustGetDB("gorm"))
+}
+
+func TestPingAndHealthCheck(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	dir := t.TempDir()
+	cfg := fileConfig(filepath.Join(dir, "health.db"))
+	cfg.Replicas = []string{filepath.Join(dir, "health_replica.db")}
+	assert.NoError(t, RegisterDataSource("healthy", cfg))
+	broken := setupTestDB(t)
+	assert.NoError(t, RegisterGorm("broken", broken))
+	sqlDB, _ := broken.DB()
+	_ = sqlDB.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, Ping(ctx, "healthy"))
+	assert.Error(t, Ping(ctx, "broken"))
+	assert.Error(t, Ping(ctx, "missing"))
+
+	report := HealthCheck(ctx)
+	assert.True(t, report["healthy"].Healthy)
+	assert.Len(t, report["healthy"].Replicas, 1)
+	assert.True(t, report["healthy"].Replicas[0].Healthy)
+	assert.False(t, report["broken"].Healthy)
+	assert.NotEmpty(t, report["broken"].Error)
+}
+
+func TestCloseAllJoinsErrors(t *testing.T) {
+	bad := setupTestDB(t)
+	bad.ConnPool = nil
+	bad.Statement.ConnPool = nil
+	assert.NoError(t, RegisterGorm("bad", bad))
+	assert.NoError(t, RegisterGorm("good", setupTestDB(t)))
+
+	err := CloseAll()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad")
+
+	// 出错也不影响其余数据源的关闭与移除
+	_, err = GetDB("good")
+	assert.Error(t, err)
+}
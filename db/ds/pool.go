@@ -0,0 +1,52 @@
+package ds
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// swapPool 可原子替换底层 *sql.DB 的连接池，Replace 时已持有该 *gorm.DB 的 Repo 无需重建即可切换到新连接
+type swapPool struct {
+	cur atomic.Pointer[sql.DB]
+}
+
+// wrapSwapPool 将 gorm 打开的连接池包装为可替换的连接池
+func wrapSwapPool(db *gorm.DB, sqlDB *sql.DB) {
+	pool := &swapPool{}
+	pool.cur.Store(sqlDB)
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+}
+
+// swap 替换底层连接池，返回旧连接池
+func (p *swapPool) swap(sqlDB *sql.DB) *sql.DB {
+	return p.cur.Swap(sqlDB)
+}
+
+func (p *swapPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.cur.Load().PrepareContext(ctx, query)
+}
+
+func (p *swapPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.cur.Load().ExecContext(ctx, query, args...)
+}
+
+func (p *swapPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.cur.Load().QueryContext(ctx, query, args...)
+}
+
+func (p *swapPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.cur.Load().QueryRowContext(ctx, query, args...)
+}
+
+func (p *swapPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.cur.Load().BeginTx(ctx, opts)
+}
+
+// GetDBConn 实现 gorm.GetDBConnector，使 (*gorm.DB).DB() 返回当前连接池
+func (p *swapPool) GetDBConn() (*sql.DB, error) {
+	return p.cur.Load(), nil
+}
@@ -0,0 +1,129 @@
+package ds
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// 从库集合，key 为主数据源名称
+var replicaMap = make(map[string]*replicaSet)
+
+// Policy 从库负载均衡策略，从候选从库中挑选一个
+type Policy interface {
+	Resolve(replicas []*gorm.DB) *gorm.DB
+}
+
+// PolicyFunc 函数形式的负载均衡策略
+type PolicyFunc func(replicas []*gorm.DB) *gorm.DB
+
+func (f PolicyFunc) Resolve(replicas []*gorm.DB) *gorm.DB {
+	return f(replicas)
+}
+
+// RoundRobinPolicy 轮询策略（默认）
+func RoundRobinPolicy() Policy {
+	var next atomic.Uint64
+	return PolicyFunc(func(replicas []*gorm.DB) *gorm.DB {
+		n := next.Add(1) - 1
+		return replicas[n%uint64(len(replicas))]
+	})
+}
+
+// RandomPolicy 随机策略
+func RandomPolicy() Policy {
+	return PolicyFunc(func(replicas []*gorm.DB) *gorm.DB {
+		return replicas[rand.IntN(len(replicas))]
+	})
+}
+
+// LeastConnPolicy 最少连接策略，选择当前使用中连接数最少的从库
+func LeastConnPolicy() Policy {
+	return PolicyFunc(func(replicas []*gorm.DB) *gorm.DB {
+		best, bestInUse := replicas[0], -1
+		for _, r := range replicas {
+			sqlDB, err := r.DB()
+			if err != nil {
+				continue
+			}
+			if inUse := sqlDB.Stats().InUse; bestInUse < 0 || inUse < bestInUse {
+				best, bestInUse = r, inUse
+			}
+		}
+		return best
+	})
+}
+
+// PolicyByName 根据名称获取内置策略：round_robin、random、least_conn，空串为默认轮询
+func PolicyByName(name string) (Policy, error) {
+	switch name {
+	case "", "round_robin":
+		return RoundRobinPolicy(), nil
+	case "random":
+		return RandomPolicy(), nil
+	case "least_conn":
+		return LeastConnPolicy(), nil
+	default:
+		return nil, errors.New("unsupported replica policy: " + name)
+	}
+}
+
+type replicaSet struct {
+	policy Policy
+	dbs    []*gorm.DB
+}
+
+// RegisterReplicas 为已注册的数据源直接挂载已有的从库 *gorm.DB，policy 为 nil 时使用轮询
+func RegisterReplicas(name string, policy Policy, replicas ...*gorm.DB) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := dbMap[name]; !exists {
+		return errors.New("data source not found: " + name)
+	}
+	for _, r := range replicas {
+		if r == nil {
+			return errors.New("replica db is nil")
+		}
+	}
+	if policy == nil {
+		policy = RoundRobinPolicy()
+	}
+	set, ok := replicaMap[name]
+	if !ok {
+		set = &replicaSet{policy: policy}
+		replicaMap[name] = set
+	}
+	set.policy = policy
+	set.dbs = append(set.dbs, replicas...)
+	return nil
+}
+
+// Replica 按负载均衡策略返回指定数据源的一个从库，未配置从库时返回 false
+func Replica(name string) (*gorm.DB, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	set, ok := replicaMap[name]
+	if !ok || len(set.dbs) == 0 {
+		return nil, false
+	}
+	if len(set.dbs) == 1 {
+		return set.dbs[0], true
+	}
+	db := set.policy.Resolve(set.dbs)
+	if db == nil {
+		return set.dbs[0], true
+	}
+	return db, true
+}
+
+// Replicas 返回指定数据源的全部从库
+func Replicas(name string) []*gorm.DB {
+	mu.RLock()
+	defer mu.RUnlock()
+	if set, ok := replicaMap[name]; ok {
+		return append([]*gorm.DB(nil), set.dbs...)
+	}
+	return nil
+}
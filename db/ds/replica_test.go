@@ -0,0 +1,71 @@
+package ds
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRegisterDataSourceWithReplicas(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	dir := t.TempDir()
+	err := RegisterDataSource("rw", DBConfig{
+		DSN:      filepath.Join(dir, "primary.db"),
+		Driver:   "sqlite",
+		LogLevel: logger.Silent,
+		Replicas: []string{filepath.Join(dir, "r1.db"), filepath.Join(dir, "r2.db")},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, Replicas("rw"), 2)
+
+	// 默认轮询，依次返回两个从库
+	first, ok := Replica("rw")
+	assert.True(t, ok)
+	second, _ := Replica("rw")
+	assert.NotSame(t, first, second)
+	third, _ := Replica("rw")
+	assert.Same(t, first, third)
+
+	_, ok = Replica("not-exist")
+	assert.False(t, ok)
+
+	assert.NoError(t, CloseAll())
+	assert.Empty(t, Replicas("rw"))
+}
+
+func TestRegisterReplicas(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	err := RegisterReplicas("missing", nil, setupTestDB(t))
+	assert.Error(t, err)
+
+	assert.NoError(t, RegisterGorm("rw", setupTestDB(t)))
+	replica := setupTestDB(t)
+	assert.NoError(t, RegisterReplicas("rw", LeastConnPolicy(), replica))
+	got, ok := Replica("rw")
+	assert.True(t, ok)
+	assert.Same(t, replica, got)
+}
+
+func TestPolicies(t *testing.T) {
+	replicas := []*gorm.DB{setupTestDB(t), setupTestDB(t), setupTestDB(t)}
+
+	rr := RoundRobinPolicy()
+	for i := 0; i < 6; i++ {
+		assert.Same(t, replicas[i%3], rr.Resolve(replicas))
+	}
+	assert.Contains(t, replicas, RandomPolicy().Resolve(replicas))
+	assert.Contains(t, replicas, LeastConnPolicy().Resolve(replicas))
+
+	for _, name := range []string{"", "round_robin", "random", "least_conn"} {
+		p, err := PolicyByName(name)
+		assert.NoError(t, err)
+		assert.NotNil(t, p)
+	}
+	_, err := PolicyByName("weighted")
+	assert.Error(t, err)
+}
@@ -0,0 +1,252 @@
+package ds
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Resolver 按操作上下文解析连接，Repo 在每次操作时调用
+type Resolver interface {
+	Resolve(ctx context.Context) (*gorm.DB, error)
+}
+
+// ResolverFunc 函数形式的 Resolver
+type ResolverFunc func(ctx context.Context) (*gorm.DB, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context) (*gorm.DB, error) {
+	return f(ctx)
+}
+
+// ErrNoTenant 上下文中没有租户信息
+var ErrNoTenant = errors.New("no tenant in context")
+
+type tenantKey struct{}
+
+// WithTenant 返回携带租户ID的上下文
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext 从上下文读取租户ID
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// DefaultIdleTimeout TenantResolver 淘汰连接池前要求的默认空闲时长
+const DefaultIdleTimeout = time.Minute
+
+// TenantResolver 按租户分库的 Resolver：从上下文读取租户ID，返回对应数据源。
+// 数据源名称为 Prefix+租户ID；已注册的同名数据源直接使用，否则通过 Config 生成配置懒注册，
+// 懒注册的连接按最近使用排序，超过 MaxOpen 时淘汰最久未使用、且距最近一次 Get 超过 IdleTimeout
+// 并无进行中查询的连接池并注销；仍在宽限期内的连接池暂不淘汰，连接数可能暂时超过 MaxOpen。
+// 被淘汰的 *gorm.DB 随即关闭，调用方不应长期持有 Get 的返回值，应在每次使用时重新解析（Repo 即如此）。
+type TenantResolver struct {
+	Prefix      string                                 // 数据源名称前缀，默认 "tenant:"
+	Config      func(tenant string) (DBConfig, error)  // 按租户生成连接配置
+	MaxOpen     int                                    // 懒注册连接数上限，<=0 表示不限制
+	IdleTimeout time.Duration                          // 淘汰前要求的空闲时长，<=0 时为 DefaultIdleTimeout
+	OnOpen      func(tenant string, db *gorm.DB) error // 懒注册后回调，可用于初始化
+
+	mu      sync.Mutex
+	lru     *list.List               // 最近使用的在前，元素为 *tenantEntry
+	entries map[string]*list.Element // 懒注册的租户
+	opening map[string]*openCall     // 正在打开连接的租户，合并并发的首次访问
+}
+
+// tenantEntry 懒注册的租户连接
+type tenantEntry struct {
+	tenant string
+	used   time.Time // 最近一次 Get 的时间
+}
+
+// openCall 一次进行中的懒注册
+type openCall struct {
+	done chan struct{}
+	db   *gorm.DB
+	err  error
+}
+
+// NewTenantResolver 创建按租户分库的 Resolver
+func NewTenantResolver(config func(tenant string) (DBConfig, error), maxOpen int) *TenantResolver {
+	return &TenantResolver{Config: config, MaxOpen: maxOpen}
+}
+
+// Resolve 实现 Resolver
+func (r *TenantResolver) Resolve(ctx context.Context) (*gorm.DB, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return r.Get(tenant)
+}
+
+// Get 返回指定租户的连接，不存在时懒注册；打开连接（Config、注册、OnOpen）不持有锁，
+// 同一租户的并发首次访问只打开一次，不影响其它租户；打开时 panic 作为错误返回给本次及等待中的调用
+func (r *TenantResolver) Get(tenant string) (db *gorm.DB, err error) {
+	name := r.name(tenant)
+	r.mu.Lock()
+	r.init()
+	// 先等待进行中的打开：其注册后、OnOpen 完成前数据源已可见，不能当作外部预先注册的连接
+	if call, ok := r.opening[tenant]; ok {
+		r.mu.Unlock()
+		<-call.done
+		return call.db, call.err
+	}
+	if db, ok := r.cached(tenant, name); ok {
+		r.mu.Unlock()
+		return db, nil
+	}
+	if r.Config == nil {
+		r.mu.Unlock()
+		return nil, errors.New("tenant data source not found: " + name)
+	}
+	call := &openCall{done: make(chan struct{})}
+	r.opening[tenant] = call
+	r.mu.Unlock()
+
+	defer func() {
+		if p := recover(); p != nil {
+			call.db, call.err = nil, fmt.Errorf("open tenant data source %s panicked: %v", name, p)
+		}
+		r.mu.Lock()
+		delete(r.opening, tenant)
+		if call.err == nil {
+			r.entries[tenant] = r.lru.PushFront(&tenantEntry{tenant: tenant, used: time.Now()})
+			r.evict()
+		}
+		r.mu.Unlock()
+		close(call.done)
+		db, err = call.db, call.err
+	}()
+	call.db, call.err = r.open(tenant, name)
+	return call.db, call.err
+}
+
+// cached 返回已懒注册或外部预先注册的连接，调用方需持有锁
+func (r *TenantResolver) cached(tenant, name string) (*gorm.DB, bool) {
+	if el, ok := r.entries[tenant]; ok {
+		if db, err := GetDB(name); err == nil {
+			el.Value.(*tenantEntry).used = time.Now()
+			r.lru.MoveToFront(el)
+			return db, true
+		}
+		// 已被外部注销
+		r.lru.Remove(el)
+		delete(r.entries, tenant)
+	}
+	if db, err := GetDB(name); err == nil {
+		// 外部预先注册的数据源，不参与淘汰
+		return db, true
+	}
+	return nil, false
+}
+
+// open 生成配置并注册租户数据源，OnOpen 失败或 panic 时注销
+func (r *TenantResolver) open(tenant, name string) (*gorm.DB, error) {
+	cfg, err := r.Config(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := RegisterDataSource(name, cfg); err != nil {
+		return nil, err
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			_ = Unregister(name)
+		}
+	}()
+	db, err := GetDB(name)
+	if err != nil {
+		return nil, err
+	}
+	if r.OnOpen != nil {
+		if err := r.OnOpen(tenant, db); err != nil {
+			return nil, err
+		}
+	}
+	opened = true
+	return db, nil
+}
+
+// Len 当前懒注册的租户连接数
+func (r *TenantResolver) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Close 注销全部懒注册的租户连接
+func (r *TenantResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+	var errs []error
+	for tenant, el := range r.entries {
+		if err := Unregister(r.name(tenant)); err != nil {
+			errs = append(errs, err)
+		}
+		r.lru.Remove(el)
+		delete(r.entries, tenant)
+	}
+	return errors.Join(errs...)
+}
+
+// evict 超出上限时从最久未使用的一端淘汰空闲连接池，宽限期内、正在使用的以及刚打开的连接池跳过
+func (r *TenantResolver) evict() {
+	if r.MaxOpen <= 0 {
+		return
+	}
+	timeout := r.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultIdleTimeout
+	}
+	now := time.Now()
+	for el := r.lru.Back(); el != nil && el != r.lru.Front() && len(r.entries) > r.MaxOpen; {
+		prev := el.Prev()
+		entry := el.Value.(*tenantEntry)
+		if now.Sub(entry.used) >= timeout && r.idle(entry.tenant) {
+			_ = Unregister(r.name(entry.tenant))
+			r.lru.Remove(el)
+			delete(r.entries, entry.tenant)
+		}
+		el = prev
+	}
+}
+
+func (r *TenantResolver) idle(tenant string) bool {
+	db, err := GetDB(r.name(tenant))
+	if err != nil {
+		return true
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return true
+	}
+	return sqlDB.Stats().InUse == 0
+}
+
+func (r *TenantResolver) name(tenant string) string {
+	if r.Prefix == "" {
+		return "tenant:" + tenant
+	}
+	return r.Prefix + tenant
+}
+
+func (r *TenantResolver) init() {
+	if r.entries == nil {
+		r.entries = make(map[string]*list.Element)
+		r.opening = make(map[string]*openCall)
+		r.lru = list.New()
+	}
+}
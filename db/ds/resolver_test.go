@@ -0,0 +1,177 @@
+package ds
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTenantContext(t *testing.T) {
+	_, ok := TenantFromContext(context.Background())
+	assert.False(t, ok)
+
+	tenant, ok := TenantFromContext(WithTenant(context.Background(), "t1"))
+	assert.True(t, ok)
+	assert.Equal(t, "t1", tenant)
+}
+
+func TestTenantResolver(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	dir := t.TempDir()
+	var opened []string
+	resolver := NewTenantResolver(func(tenant string) (DBConfig, error) {
+		return DBConfig{DSN: filepath.Join(dir, tenant+".db"), Driver: "sqlite", LogLevel: logger.Silent}, nil
+	}, 2)
+	resolver.OnOpen = func(tenant string, db *gorm.DB) error {
+		opened = append(opened, tenant)
+		return nil
+	}
+
+	_, err := resolver.Resolve(context.Background())
+	assert.ErrorIs(t, err, ErrNoTenant)
+
+	a, err := resolver.Resolve(WithTenant(context.Background(), "a"))
+	assert.NoError(t, err)
+	again, _ := resolver.Resolve(WithTenant(context.Background(), "a"))
+	assert.Same(t, a, again)
+
+	// 宽限期内的连接池不淘汰，持有的连接仍可使用
+	b, _ := resolver.Get("b")
+	_, _ = resolver.Get("c")
+	assert.Equal(t, 3, resolver.Len())
+	assert.NoError(t, b.Exec("SELECT 1").Error)
+
+	resolver.IdleTimeout = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	_, _ = resolver.Get("a") // a 变为最近使用
+	_, _ = resolver.Get("d") // 超出上限，淘汰最久未使用且已空闲的 b、c
+	assert.Equal(t, 2, resolver.Len())
+	assert.Equal(t, []string{"a", "b", "c", "d"}, opened)
+	_, err = GetDB("tenant:b")
+	assert.Error(t, err)
+	_, err = GetDB("tenant:a")
+	assert.NoError(t, err)
+
+	// 外部预注册的数据源直接使用，不计入上限
+	shared := setupTestDB(t)
+	assert.NoError(t, RegisterGorm("tenant:vip", shared))
+	vip, err := resolver.Get("vip")
+	assert.NoError(t, err)
+	assert.Same(t, shared, vip)
+	assert.Equal(t, 2, resolver.Len())
+
+	assert.NoError(t, resolver.Close())
+	assert.Equal(t, 0, resolver.Len())
+	_, err = GetDB("tenant:a")
+	assert.Error(t, err)
+}
+
+func TestTenantResolverOpensOutsideLock(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	dir := t.TempDir()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var slowOpens atomic.Int32
+	resolver := NewTenantResolver(func(tenant string) (DBConfig, error) {
+		if tenant == "slow" {
+			slowOpens.Add(1)
+			close(entered)
+			<-release
+		}
+		return DBConfig{DSN: filepath.Join(dir, tenant+".db"), Driver: "sqlite", LogLevel: logger.Silent}, nil
+	}, 0)
+
+	var wg sync.WaitGroup
+	slow := make([]*gorm.DB, 2)
+	for i := range slow {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slow[i], _ = resolver.Get("slow")
+		}()
+	}
+	<-entered
+
+	// 慢租户打开连接时不阻塞其它租户
+	done := make(chan error, 1)
+	go func() {
+		_, err := resolver.Get("fast")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("opening a slow tenant should not block other tenants")
+	}
+
+	// 同一租户的并发首次访问只打开一次
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), slowOpens.Load())
+	assert.NotNil(t, slow[0])
+	assert.Same(t, slow[0], slow[1])
+}
+
+func TestTenantResolverOpenPanic(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	dir := t.TempDir()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	resolver := NewTenantResolver(func(tenant string) (DBConfig, error) {
+		return DBConfig{DSN: filepath.Join(dir, tenant+".db"), Driver: "sqlite", LogLevel: logger.Silent}, nil
+	}, 0)
+	var fail atomic.Bool
+	var once sync.Once
+	fail.Store(true)
+	resolver.OnOpen = func(tenant string, db *gorm.DB) error {
+		if fail.Load() {
+			once.Do(func() { close(entered) })
+			<-release
+			panic("boom")
+		}
+		return nil
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := resolver.Get("p")
+		first <- err
+	}()
+	<-entered
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := resolver.Get("p")
+		waiter <- err
+	}()
+	close(release)
+
+	// panic 作为错误返回给打开者与等待者，不阻塞
+	for _, ch := range []chan error{first, waiter} {
+		select {
+		case err := <-ch:
+			assert.ErrorContains(t, err, "panicked: boom")
+		case <-time.After(2 * time.Second):
+			t.Fatal("get should not block after open panicked")
+		}
+	}
+	assert.Equal(t, 0, resolver.Len())
+	_, err := GetDB("tenant:p")
+	assert.Error(t, err)
+
+	// 之后可重新打开
+	fail.Store(false)
+	db, err := resolver.Get("p")
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+}
@@ -0,0 +1,288 @@
+package ds
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// 每个数据源下已注册的模型，key 为数据源名称，用于 Diff 时遍历
+var models = make(map[string][]any)
+
+// ChangeKind 表结构差异类型
+type ChangeKind string
+
+const (
+	ChangeCreateTable ChangeKind = "create_table" // 表不存在，需要建表
+	ChangeAddColumn   ChangeKind = "add_column"   // 模型有而表中缺失的列
+	ChangeAlterColumn ChangeKind = "alter_column" // 列类型、长度或可空性不一致
+	ChangeExtraColumn ChangeKind = "extra_column" // 表中多出的列（AutoMigrate 不会删除，仅提示）
+	ChangeAddIndex    ChangeKind = "add_index"    // 模型声明而表中缺失的索引
+	ChangeExtraIndex  ChangeKind = "extra_index"  // 表中多出的索引（仅提示）
+)
+
+// SchemaChange 描述一处模型与实际表结构的差异
+type SchemaChange struct {
+	Kind   ChangeKind `json:"kind"`
+	Table  string     `json:"table"`
+	Column string     `json:"column,omitempty"`
+	Index  string     `json:"index,omitempty"`
+	Detail string     `json:"detail,omitempty"` // 差异说明，例如 "type: varchar(64) -> text"
+}
+
+// TablePlan 单个模型（表）的迁移计划
+type TablePlan struct {
+	Model   string         `json:"model"`   // 模型类型名
+	Table   string         `json:"table"`   // 表名
+	Changes []SchemaChange `json:"changes"` // 结构差异
+	DDL     []string       `json:"ddl"`     // AutoMigrate 将会执行的 DDL，仅生成不执行
+}
+
+// SchemaPlan 数据源级别的迁移计划
+type SchemaPlan struct {
+	DataSource string      `json:"data_source"`
+	Tables     []TablePlan `json:"tables"`
+}
+
+// HasChanges 是否存在任何差异
+func (p *SchemaPlan) HasChanges() bool {
+	for _, t := range p.Tables {
+		if len(t.Changes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Statements 按顺序汇总所有 DDL 语句
+func (p *SchemaPlan) Statements() []string {
+	var res []string
+	for _, t := range p.Tables {
+		res = append(res, t.DDL...)
+	}
+	return res
+}
+
+// RegisterModel 将模型登记到指定数据源下，供 Diff 遍历；重复登记同一类型会被忽略
+func RegisterModel(name string, values ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range values {
+		typ := modelType(v)
+		exists := false
+		for _, m := range models[name] {
+			if modelType(m) == typ {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			models[name] = append(models[name], v)
+		}
+	}
+}
+
+// Diff 对比指定数据源下所有已登记模型与实际表结构，返回迁移计划（不执行任何 DDL）
+func Diff(name string) (*SchemaPlan, error) {
+	db, err := GetDB(name)
+	if err != nil {
+		return nil, err
+	}
+	mu.RLock()
+	values := append([]any(nil), models[name]...)
+	mu.RUnlock()
+
+	plan, err := DiffModels(db, values...)
+	if err != nil {
+		return nil, err
+	}
+	plan.DataSource = name
+	return plan, nil
+}
+
+// DiffModels 对比给定模型与 db 中实际表结构，返回迁移计划（不执行任何 DDL）
+func DiffModels(db *gorm.DB, values ...any) (*SchemaPlan, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	// 内省时屏蔽日志（部分驱动的 GetIndexes 会强制 Debug 输出）
+	inspect := db.Session(&gorm.Session{NewDB: true, Logger: logger.Discard})
+	plan := &SchemaPlan{}
+	for _, v := range values {
+		tp, err := diffModel(inspect, v)
+		if err != nil {
+			return nil, err
+		}
+		plan.Tables = append(plan.Tables, *tp)
+	}
+	return plan, nil
+}
+
+func diffModel(db *gorm.DB, value any) (*TablePlan, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return nil, err
+	}
+	tp := &TablePlan{Model: modelType(value).Name(), Table: stmt.Table}
+	m := db.Migrator()
+	rec := newDDLRecorder(db)
+
+	if !m.HasTable(value) {
+		tp.Changes = append(tp.Changes, SchemaChange{Kind: ChangeCreateTable, Table: stmt.Table})
+		tp.DDL = rec.record(func(dry gorm.Migrator) error { return dry.CreateTable(value) })
+		return tp, nil
+	}
+
+	columnTypes, err := m.ColumnTypes(value)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]gorm.ColumnType, len(columnTypes))
+	for _, ct := range columnTypes {
+		live[strings.ToLower(ct.Name())] = ct
+	}
+
+	declared := make(map[string]bool)
+	for _, dbName := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[dbName]
+		if field == nil || field.IgnoreMigration {
+			continue
+		}
+		declared[strings.ToLower(dbName)] = true
+		ct, ok := live[strings.ToLower(dbName)]
+		if !ok {
+			tp.Changes = append(tp.Changes, SchemaChange{Kind: ChangeAddColumn, Table: stmt.Table, Column: dbName,
+				Detail: strings.ToLower(m.FullDataTypeOf(field).SQL)})
+			tp.DDL = append(tp.DDL, rec.record(func(dry gorm.Migrator) error { return dry.AddColumn(value, dbName) })...)
+			continue
+		}
+		if detail := columnDrift(m, field, ct); detail != "" {
+			tp.Changes = append(tp.Changes, SchemaChange{Kind: ChangeAlterColumn, Table: stmt.Table, Column: dbName, Detail: detail})
+			tp.DDL = append(tp.DDL, rec.alterColumn(value, stmt.Table, field)...)
+		}
+	}
+	for _, ct := range columnTypes {
+		if !declared[strings.ToLower(ct.Name())] {
+			tp.Changes = append(tp.Changes, SchemaChange{Kind: ChangeExtraColumn, Table: stmt.Table, Column: ct.Name(),
+				Detail: "column not declared in model"})
+		}
+	}
+
+	declaredIdx := make(map[string]bool)
+	for _, idx := range stmt.Schema.ParseIndexes() {
+		declaredIdx[idx.Name] = true
+		if m.HasIndex(value, idx.Name) {
+			continue
+		}
+		name := idx.Name
+		tp.Changes = append(tp.Changes, SchemaChange{Kind: ChangeAddIndex, Table: stmt.Table, Index: name, Detail: indexColumns(idx)})
+		tp.DDL = append(tp.DDL, rec.record(func(dry gorm.Migrator) error { return dry.CreateIndex(value, name) })...)
+	}
+	if indexes, err := m.GetIndexes(value); err == nil {
+		for _, idx := range indexes {
+			if pk, ok := idx.PrimaryKey(); ok && pk {
+				continue
+			}
+			if !declaredIdx[idx.Name()] {
+				tp.Changes = append(tp.Changes, SchemaChange{Kind: ChangeExtraIndex, Table: stmt.Table, Index: idx.Name(),
+					Detail: "index not declared in model"})
+			}
+		}
+	}
+	return tp, nil
+}
+
+// columnDrift 参照 gorm MigrateColumn 的判定规则比较列定义，返回差异说明，无差异返回空串
+func columnDrift(m gorm.Migrator, field *schema.Field, ct gorm.ColumnType) string {
+	var details []string
+	fullDataType := strings.TrimSpace(strings.ToLower(m.FullDataTypeOf(field).SQL))
+	realDataType := strings.ToLower(ct.DatabaseTypeName())
+
+	sameType := fullDataType == realDataType || strings.HasPrefix(fullDataType, realDataType)
+	if !sameType {
+		for _, alias := range m.GetTypeAliases(realDataType) {
+			if strings.HasPrefix(fullDataType, alias) {
+				sameType = true
+				break
+			}
+		}
+	}
+	if !field.PrimaryKey && !sameType {
+		details = append(details, fmt.Sprintf("type: %s -> %s", realDataType, fullDataType))
+	}
+	if length, ok := ct.Length(); ok && length > 0 && field.Size > 0 && length != int64(field.Size) {
+		details = append(details, fmt.Sprintf("size: %d -> %d", length, field.Size))
+	}
+	if nullable, ok := ct.Nullable(); ok && !field.PrimaryKey && nullable == field.NotNull {
+		details = append(details, fmt.Sprintf("nullable: %t -> %t", nullable, !field.NotNull))
+	}
+	return strings.Join(details, "; ")
+}
+
+func indexColumns(idx *schema.Index) string {
+	cols := make([]string, 0, len(idx.Fields))
+	for _, f := range idx.Fields {
+		if f.Field != nil {
+			cols = append(cols, f.DBName)
+		} else {
+			cols = append(cols, f.Expression)
+		}
+	}
+	return strings.Join(cols, ",")
+}
+
+func modelType(v any) reflect.Type {
+	typ := reflect.TypeOf(v)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// ddlRecorder 通过 DryRun 会话捕获 Migrator 生成的 DDL 而不执行
+type ddlRecorder struct {
+	db  *gorm.DB
+	sql []string
+}
+
+func newDDLRecorder(db *gorm.DB) *ddlRecorder {
+	return &ddlRecorder{db: db}
+}
+
+func (r *ddlRecorder) record(fn func(dry gorm.Migrator) error) []string {
+	r.sql = nil
+	dry := r.db.Session(&gorm.Session{DryRun: true, NewDB: true, Logger: r})
+	if err := fn(dry.Migrator()); err != nil {
+		return append(r.sql, "-- "+err.Error())
+	}
+	return r.sql
+}
+
+// alterColumn sqlite 修改列需要重建表（重建时会读取线上 DDL，DryRun 下无法执行），此处只给出说明
+func (r *ddlRecorder) alterColumn(value any, table string, field *schema.Field) []string {
+	if r.db.Dialector.Name() == "sqlite" {
+		return []string{fmt.Sprintf("-- sqlite: rebuild table `%s` to alter column `%s` %s",
+			table, field.DBName, r.db.Migrator().FullDataTypeOf(field).SQL)}
+	}
+	return r.record(func(dry gorm.Migrator) error { return dry.AlterColumn(value, field.DBName) })
+}
+
+func (r *ddlRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *ddlRecorder) Info(context.Context, string, ...interface{}) {}
+
+func (r *ddlRecorder) Warn(context.Context, string, ...interface{}) {}
+
+func (r *ddlRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *ddlRecorder) Trace(_ context.Context, _ time.Time, fc func() (sql string, rowsAffected int64), _ error) {
+	if sql, _ := fc(); sql != "" {
+		r.sql = append(r.sql, sql)
+	}
+}
@@ -0,0 +1,71 @@
+package ds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaUser struct {
+	ID    int64  `gorm:"primaryKey;autoIncrement"`
+	Name  string `gorm:"type:varchar(64);not null;index:idx_schema_user_name"`
+	Email string `gorm:"type:varchar(128)"`
+}
+
+func (schemaUser) TableName() string { return "schema_users" }
+
+func TestDiffCreateTable(t *testing.T) {
+	defer func() { _ = CloseAll() }()
+
+	db := setupTestDB(t)
+	assert.NoError(t, RegisterGorm("diff", db))
+	RegisterModel("diff", &schemaUser{}, schemaUser{})
+
+	plan, err := Diff("diff")
+	assert.NoError(t, err)
+	assert.Equal(t, "diff", plan.DataSource)
+	assert.Len(t, plan.Tables, 1)
+	assert.True(t, plan.HasChanges())
+	assert.Equal(t, ChangeCreateTable, plan.Tables[0].Changes[0].Kind)
+	assert.NotEmpty(t, plan.Statements())
+	assert.True(t, strings.HasPrefix(plan.Statements()[0], "CREATE TABLE"))
+
+	// 仅生成计划，不应真正建表
+	assert.False(t, db.Migrator().HasTable(&schemaUser{}))
+}
+
+func TestDiffColumnsAndIndexes(t *testing.T) {
+	db := setupTestDB(t)
+	err := db.Exec("CREATE TABLE schema_users (id integer PRIMARY KEY AUTOINCREMENT, name text, legacy text)").Error
+	assert.NoError(t, err)
+
+	plan, err := DiffModels(db, &schemaUser{})
+	assert.NoError(t, err)
+
+	kinds := map[ChangeKind][]string{}
+	for _, c := range plan.Tables[0].Changes {
+		kinds[c.Kind] = append(kinds[c.Kind], c.Column+c.Index)
+	}
+	assert.Equal(t, []string{"email"}, kinds[ChangeAddColumn])
+	assert.Equal(t, []string{"name"}, kinds[ChangeAlterColumn])
+	assert.Equal(t, []string{"legacy"}, kinds[ChangeExtraColumn])
+	assert.Equal(t, []string{"idx_schema_user_name"}, kinds[ChangeAddIndex])
+
+	ddl := strings.Join(plan.Statements(), "\n")
+	assert.Contains(t, ddl, "ALTER TABLE `schema_users` ADD `email`")
+	assert.Contains(t, ddl, "CREATE INDEX `idx_schema_user_name`")
+
+	// 计划中的 DDL 不应被执行
+	assert.False(t, db.Migrator().HasColumn(&schemaUser{}, "email"))
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&schemaUser{}))
+
+	plan, err := DiffModels(db, &schemaUser{})
+	assert.NoError(t, err)
+	assert.False(t, plan.HasChanges(), "%+v", plan.Tables)
+	assert.Empty(t, plan.Statements())
+}
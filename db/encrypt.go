@@ -0,0 +1,674 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+	"gorm.io/gorm"
+	gclause "gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TagEncrypt 加密字段标记 `dubhe:"encrypt"`，仅支持 string 字段；
+// 模型存在 <列名>_bidx 列时同时写入盲索引，用于等值查询
+const TagEncrypt = "encrypt"
+
+const (
+	blindIndexSuffix = "_bidx"
+	cipherPrefix     = "enc:" // 密文格式 enc:<密钥ID>:<base64(nonce+密文)>
+	maskedValue      = "******"
+)
+
+// region Key Provider
+
+// KeyProvider 字段加密的密钥来源，加密密钥为 AES-128/192/256 密钥（16/24/32 字节）
+type KeyProvider interface {
+	// CurrentKey 加密新数据使用的密钥及其ID，ID 不能包含 ":"
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key 按ID获取密钥，用于解密以历史密钥加密的数据
+	Key(ctx context.Context, id string) ([]byte, error)
+	// BlindKey 盲索引的 HMAC 密钥，更换后需重建盲索引列
+	BlindKey(ctx context.Context) ([]byte, error)
+}
+
+// StaticKeys 固定密钥的 KeyProvider：新数据以 Current 对应的密钥加密，Keys 保留历史密钥用于解密
+type StaticKeys struct {
+	Current string            // 当前密钥ID
+	Keys    map[string][]byte // 密钥ID -> 密钥
+	Blind   []byte            // 盲索引 HMAC 密钥
+}
+
+func (s StaticKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := s.Key(ctx, s.Current)
+	return s.Current, key, err
+}
+
+func (s StaticKeys) Key(_ context.Context, id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("db: encryption key %q not found", id)
+	}
+	return key, nil
+}
+
+func (s StaticKeys) BlindKey(context.Context) ([]byte, error) {
+	if len(s.Blind) == 0 {
+		return nil, fmt.Errorf("db: blind index key is empty")
+	}
+	return s.Blind, nil
+}
+
+// endregion Key Provider
+
+// region Field Cipher
+
+// encryptedField 加密字段及其盲索引字段（可为空）
+type encryptedField struct {
+	field *schema.Field
+	index *schema.Field
+}
+
+type encryptedFieldsResult struct {
+	fields []encryptedField
+	err    error
+}
+
+// 按 schema 缓存的加密字段
+var encryptedFieldsCache sync.Map
+
+var stringType = reflect.TypeFor[string]()
+
+// encryptedFieldsOf 解析模型中标记为加密的字段
+func encryptedFieldsOf(sch *schema.Schema) ([]encryptedField, error) {
+	if cached, ok := encryptedFieldsCache.Load(sch); ok {
+		res := cached.(encryptedFieldsResult)
+		return res.fields, res.err
+	}
+	var res encryptedFieldsResult
+	for _, field := range sch.Fields {
+		if field.Tag.Get("dubhe") != TagEncrypt || field.DBName == "" {
+			continue
+		}
+		if field.FieldType != stringType {
+			res.err = fmt.Errorf("%s: encrypted field %s must be a string, got %s", sch.Table, field.Name, field.FieldType)
+			break
+		}
+		ef := encryptedField{field: field}
+		if index := sch.LookUpField(field.DBName + blindIndexSuffix); index != nil {
+			if index.FieldType != stringType {
+				res.err = fmt.Errorf("%s: blind index field %s must be a string, got %s", sch.Table, index.Name, index.FieldType)
+				break
+			}
+			ef.index = index
+		}
+		res.fields = append(res.fields, ef)
+	}
+	encryptedFieldsCache.Store(sch, res)
+	return res.fields, res.err
+}
+
+// fieldCipher 单次操作内的加解密，按需获取密钥
+type fieldCipher struct {
+	ctx    context.Context
+	keys   KeyProvider
+	id     string
+	sealer cipher.AEAD
+	opened map[string]cipher.AEAD
+	blind  []byte
+}
+
+func newFieldCipher(ctx context.Context, keys KeyProvider) *fieldCipher {
+	return &fieldCipher{ctx: ctx, keys: keys}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt 以当前密钥加密，空串保持不变
+func (c *fieldCipher) encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if c.sealer == nil {
+		id, key, err := c.keys.CurrentKey(c.ctx)
+		if err != nil {
+			return "", err
+		}
+		if id == "" || strings.Contains(id, ":") {
+			return "", fmt.Errorf("db: invalid encryption key id %q", id)
+		}
+		if c.sealer, err = newAEAD(key); err != nil {
+			return "", err
+		}
+		c.id = id
+	}
+	nonce := make([]byte, c.sealer.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.sealer.Seal(nonce, nonce, []byte(plain), nil)
+	return cipherPrefix + c.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt 按密文中的密钥ID解密，非密文（如加密前写入的存量数据）原样返回
+func (c *fieldCipher) decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, cipherPrefix)
+	if !ok {
+		return value, nil
+	}
+	id, data, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", fmt.Errorf("db: malformed ciphertext")
+	}
+	aead, ok := c.opened[id]
+	if !ok {
+		key, err := c.keys.Key(c.ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if aead, err = newAEAD(key); err != nil {
+			return "", err
+		}
+		if c.opened == nil {
+			c.opened = make(map[string]cipher.AEAD)
+		}
+		c.opened[id] = aead
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("db: malformed ciphertext: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("db: malformed ciphertext")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("db: decrypt with key %q: %w", id, err)
+	}
+	return string(plain), nil
+}
+
+// blindIndex 计算列值的盲索引（HMAC-SHA256，按列名区分），空串保持不变
+func (c *fieldCipher) blindIndex(column, plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if c.blind == nil {
+		key, err := c.keys.BlindKey(c.ctx)
+		if err != nil {
+			return "", err
+		}
+		c.blind = key
+	}
+	mac := hmac.New(sha256.New, c.blind)
+	mac.Write([]byte(column + ":" + plain))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// seal 将加密字段 ef 的写入值 v（须为 string）转换为密文，ef 有盲索引列时同时计算盲索引；
+// 写入回调与工作单元的批量更新共用
+func (c *fieldCipher) seal(table string, ef encryptedField, v any) (sealed, index string, err error) {
+	plain, ok := v.(string)
+	if !ok {
+		return "", "", fmt.Errorf("%s: encrypted column %s must be set to a string, got %T", table, ef.field.DBName, v)
+	}
+	if sealed, err = c.encrypt(plain); err != nil {
+		return "", "", err
+	}
+	if ef.index != nil {
+		if index, err = c.blindIndex(ef.field.DBName, plain); err != nil {
+			return "", "", err
+		}
+	}
+	return sealed, index, nil
+}
+
+// blindValue 将等值/IN 条件的值转换为盲索引
+func (c *fieldCipher) blindValue(column string, value any) (any, error) {
+	if s, ok := value.(string); ok {
+		return c.blindIndex(column, s)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("db: encrypted column %s must be matched with strings, got %T", column, value)
+	}
+	res := make([]string, rv.Len())
+	for i := range res {
+		s, ok := rv.Index(i).Interface().(string)
+		if !ok {
+			return nil, fmt.Errorf("db: encrypted column %s must be matched with strings, got %s", column, rv.Type())
+		}
+		var err error
+		if res[i], err = c.blindIndex(column, s); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// endregion Field Cipher
+
+// region Encryption Callbacks
+
+type keyProviderKey struct{}
+
+// withKeyProvider 返回携带字段加密密钥的上下文，加解密回调只处理携带密钥的语句
+func withKeyProvider(ctx context.Context, keys KeyProvider) context.Context {
+	return context.WithValue(ctx, keyProviderKey{}, keys)
+}
+
+// 已注册加解密回调的连接
+var (
+	encryptionRegistered sync.Map
+	encryptionMu         sync.Mutex
+)
+
+// registerEncryption 为连接注册加解密回调：写入前加密并计算盲索引，写入后恢复明文，查询后解密
+func registerEncryption(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if _, ok := encryptionRegistered.Load(callbacks); ok {
+		return nil
+	}
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	if _, ok := encryptionRegistered.Load(callbacks); ok {
+		return nil
+	}
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("dubhe:encrypt", encryptBeforeWrite),
+		callbacks.Create().After("gorm:create").Register("dubhe:encrypt_restore", restoreAfterWrite),
+		callbacks.Update().Before("gorm:update").Register("dubhe:encrypt", encryptBeforeWrite),
+		callbacks.Update().After("gorm:update").Register("dubhe:encrypt_restore", restoreAfterWrite),
+		callbacks.Query().After("gorm:query").Register("dubhe:decrypt", decryptAfterQuery),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	encryptionRegistered.Store(callbacks, struct{}{})
+	return nil
+}
+
+// statementCipher 语句携带密钥且模型包含加密字段时返回加解密器
+func statementCipher(db *gorm.DB) (*fieldCipher, []encryptedField, bool) {
+	stmt := db.Statement
+	if stmt.Schema == nil || stmt.Context == nil {
+		return nil, nil, false
+	}
+	keys, ok := stmt.Context.Value(keyProviderKey{}).(KeyProvider)
+	if !ok {
+		return nil, nil, false
+	}
+	fields, err := encryptedFieldsOf(stmt.Schema)
+	if err != nil {
+		_ = db.AddError(err)
+		return nil, nil, false
+	}
+	if len(fields) == 0 {
+		return nil, nil, false
+	}
+	return newFieldCipher(stmt.Context, keys), fields, true
+}
+
+// eachModel 对 rv 中类型为 typ 的每个可寻址结构体执行 fn，支持结构体、切片与指针切片
+func eachModel(rv reflect.Value, typ reflect.Type, fn func(reflect.Value) error) error {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.Type() == typ && rv.CanAddr() {
+			return fn(rv)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := eachModel(rv.Index(i), typ, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// plainValue 写入后需要恢复明文的字段
+type plainValue struct {
+	rv    reflect.Value
+	field *schema.Field
+	plain string
+}
+
+const restoreSetting = "dubhe:encrypt_restore"
+
+// encryptBeforeWrite 将待写入的加密字段替换为密文并写入盲索引；按 map 更新时改写赋值
+func encryptBeforeWrite(db *gorm.DB) {
+	c, fields, ok := statementCipher(db)
+	if !ok || db.Error != nil {
+		return
+	}
+	stmt := db.Statement
+	if sets, ok := stmt.Dest.(map[string]any); ok {
+		res := make(map[string]any, len(sets))
+		for k, v := range sets {
+			res[k] = v
+		}
+		for k, v := range sets {
+			// 表达式由调用方负责加密（如工作单元的批量更新）
+			if _, ok := v.(gclause.Expr); ok {
+				continue
+			}
+			field := stmt.Schema.LookUpField(k)
+			for _, ef := range fields {
+				if ef.field != field {
+					continue
+				}
+				sealed, index, err := c.seal(stmt.Schema.Table, ef, v)
+				if err != nil {
+					_ = db.AddError(err)
+					return
+				}
+				res[k] = sealed
+				if ef.index != nil {
+					res[ef.index.DBName] = index
+				}
+			}
+		}
+		stmt.Dest = res
+		return
+	}
+	// 按结构体更新时 Dest 可能与 Model 不同，以 Dest 为准
+	target := stmt.ReflectValue
+	if stmt.Dest != nil {
+		target = reflect.ValueOf(stmt.Dest)
+	}
+	var restores []plainValue
+	err := eachModel(target, stmt.Schema.ModelType, func(rv reflect.Value) error {
+		for _, ef := range fields {
+			v, _ := ef.field.ValueOf(stmt.Context, rv)
+			sealed, index, err := c.seal(stmt.Schema.Table, ef, v)
+			if err != nil {
+				return err
+			}
+			if err := ef.field.Set(stmt.Context, rv, sealed); err != nil {
+				return err
+			}
+			restores = append(restores, plainValue{rv: rv, field: ef.field, plain: v.(string)})
+			if ef.index != nil {
+				if err := ef.index.Set(stmt.Context, rv, index); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if len(restores) > 0 {
+		db.InstanceSet(restoreSetting, restores)
+	}
+	if err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+// restoreAfterWrite 写入完成（含失败）后将实体的加密字段恢复为明文
+func restoreAfterWrite(db *gorm.DB) {
+	v, ok := db.InstanceGet(restoreSetting)
+	if !ok {
+		return
+	}
+	for _, p := range v.([]plainValue) {
+		_ = p.field.Set(db.Statement.Context, p.rv, p.plain)
+	}
+}
+
+// decryptAfterQuery 解密查询结果中的加密字段
+func decryptAfterQuery(db *gorm.DB) {
+	c, fields, ok := statementCipher(db)
+	if !ok || db.Error != nil {
+		return
+	}
+	if err := decryptModels(c, fields, db.Statement.Schema.ModelType, db.Statement.ReflectValue); err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+func decryptModels(c *fieldCipher, fields []encryptedField, typ reflect.Type, rv reflect.Value) error {
+	return eachModel(rv, typ, func(rv reflect.Value) error {
+		for _, ef := range fields {
+			v, zero := ef.field.ValueOf(c.ctx, rv)
+			if zero {
+				continue
+			}
+			plain, err := c.decrypt(v.(string))
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", ef.field.Schema.Table, ef.field.DBName, err)
+			}
+			if err := ef.field.Set(c.ctx, rv, plain); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// endregion Encryption Callbacks
+
+// region Repo Encryption
+
+// encrypted 是否配置了字段加密
+func (r *Repo[T, K]) encrypted() bool {
+	return r.cfg.Encryption != nil
+}
+
+// decryptRaw 解密原生 SQL 查询扫描出的实体（Scan 不经过查询回调）
+func (r *Repo[T, K]) decryptRaw(db *gorm.DB, models []T) error {
+	if !r.encrypted() || len(models) == 0 {
+		return nil
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	fields, err := encryptedFieldsOf(sch)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	c := newFieldCipher(r.context(), r.cfg.Encryption)
+	return decryptModels(c, fields, sch.ModelType, reflect.ValueOf(models))
+}
+
+// blindMatch 将加密字段上的 Eq/NEq/In 条件改写为盲索引列匹配，其它比较无法在密文上执行
+func (r *Repo[T, K]) blindMatch(db *gorm.DB, m *clause.Match) (*clause.Match, error) {
+	if !r.encrypted() || len(m.Clauses) == 0 {
+		return m, nil
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := encryptedFieldsOf(sch)
+	if err != nil || len(fields) == 0 {
+		return m, err
+	}
+	var c *fieldCipher
+	res := m
+	for i, cl := range m.Clauses {
+		field := sch.LookUpField(cl.Field)
+		if field == nil {
+			continue
+		}
+		for _, ef := range fields {
+			if ef.field != field {
+				continue
+			}
+			switch cl.Op {
+			case clause.OpNull, clause.OpNotNull:
+				continue
+			case clause.OpEq, clause.OpNEq, clause.OpIn:
+			default:
+				return nil, fmt.Errorf("%s: %s on encrypted column %s is not supported", r.key, cl.Op, field.DBName)
+			}
+			if ef.index == nil {
+				return nil, fmt.Errorf("%s: matching encrypted column %s requires blind index column %s", r.key, field.DBName, field.DBName+blindIndexSuffix)
+			}
+			if c == nil {
+				c = newFieldCipher(r.context(), r.cfg.Encryption)
+			}
+			value, err := c.blindValue(field.DBName, cl.Value)
+			if err != nil {
+				return nil, err
+			}
+			if res == m {
+				res = m.Clone()
+			}
+			res.Clauses[i] = clause.Clause{Field: ef.index.DBName, Op: cl.Op, Value: value}
+		}
+	}
+	return res, nil
+}
+
+// auditValue 审计记录中加密字段的值以掩码代替，盲索引列不记录
+func auditValue(sch *schema.Schema, field *schema.Field) (masked, skip bool) {
+	fields, _ := encryptedFieldsOf(sch)
+	for _, ef := range fields {
+		if ef.field == field {
+			return true, false
+		}
+		if ef.index == field {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// maskEncrypted 领域事件与发件箱中实体副本的加密字段以掩码代替，盲索引清空，避免明文随消息外发
+func (r *Repo[T, K]) maskEncrypted(entities []T) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	db, err := r.conn()
+	if err != nil {
+		return err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	fields, err := encryptedFieldsOf(sch)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	ctx := r.context()
+	for i := range entities {
+		rv := reflect.ValueOf(&entities[i]).Elem()
+		for _, ef := range fields {
+			if err := ef.field.Set(ctx, rv, maskedValue); err != nil {
+				return err
+			}
+			if ef.index != nil {
+				if err := ef.index.Set(ctx, rv, ""); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Reencrypt 将以非当前密钥加密或尚未加密的存量数据以当前密钥重新加密并补齐盲索引，
+// 每批处理 batch 条，返回更新行数；用于密钥轮换与开启加密后迁移存量数据
+func Reencrypt[T IModel[K], K Key](repo IRepo[T, K], batch int) (int64, error) {
+	r, ok := repo.(*Repo[T, K])
+	if !ok {
+		return 0, fmt.Errorf("reencrypt: unsupported repo %T", repo)
+	}
+	return r.reencrypt(batch)
+}
+
+func (r *Repo[T, K]) reencrypt(batch int) (int64, error) {
+	if !r.encrypted() {
+		return 0, fmt.Errorf("%s: encryption is not configured", r.key)
+	}
+	if r.sharded() {
+		return 0, fmt.Errorf("%s: reencrypt does not support sharded repos", r.key)
+	}
+	if batch <= 0 {
+		batch = 500
+	}
+	db, err := r.conn()
+	if err != nil {
+		return 0, err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return 0, err
+	}
+	fields, err := encryptedFieldsOf(sch)
+	if err != nil || len(fields) == 0 {
+		return 0, err
+	}
+	id, _, err := r.cfg.Encryption.CurrentKey(r.context())
+	if err != nil {
+		return 0, err
+	}
+	// 非空且不以当前密钥前缀开头的值需要重新加密
+	prefix := cipherPrefix + id + ":"
+	conds := make([]string, len(fields))
+	args := make([]any, len(fields))
+	for i, ef := range fields {
+		col := ef.field.DBName
+		conds[i] = fmt.Sprintf("(%s <> '' AND SUBSTR(%s, 1, %d) <> ?)", col, col, len(prefix))
+		args[i] = prefix
+	}
+	stale := r.Primary().Where("("+strings.Join(conds, " OR ")+")", args...).Limit(int64(batch))
+	ctx := r.context()
+	var total int64
+	for {
+		list, err := stale.List()
+		if err != nil {
+			return total, err
+		}
+		var n int64
+		for i := range list {
+			c, err := r.whereKey(list[i].GetID())
+			if err != nil {
+				return total, err
+			}
+			db, err := c.writeDB()
+			if err != nil {
+				return total, err
+			}
+			rv := reflect.ValueOf(&list[i]).Elem()
+			sets := make(map[string]any, len(fields))
+			for _, ef := range fields {
+				sets[ef.field.DBName], _ = ef.field.ValueOf(ctx, rv)
+			}
+			sql, args := c.match.WhereSql()
+			result := db.Model(new(T)).Where(sql, args...).UpdateColumns(sets)
+			if result.Error != nil {
+				return total, result.Error
+			}
+			c.invalidate(list[i].GetID())
+			n += result.RowsAffected
+		}
+		total += n
+		// 本批没有更新任何行时停止，避免条件外的限制（如租户）导致死循环
+		if len(list) < batch || n == 0 {
+			return total, nil
+		}
+	}
+}
+
+// endregion Repo Encryption
@@ -0,0 +1,184 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+var patientKeys = &db.StaticKeys{
+	Current: "k1",
+	Keys: map[string][]byte{
+		"k1": []byte("0123456789abcdef0123456789abcdef"),
+		"k2": []byte("fedcba9876543210fedcba9876543210"),
+	},
+	Blind: []byte("blind-index-key"),
+}
+
+type Patient struct {
+	db.ModelI64
+	Name      string
+	Phone     string `dubhe:"encrypt"`
+	PhoneBidx string `gorm:"size:64;index"`
+	IDCard    string `dubhe:"encrypt"`
+}
+
+func (Patient) TableName() string { return "patients" }
+func (Patient) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Encryption: patientKeys}
+}
+
+// storedPhone 绕过 Repo 读取库中的原始列值
+func storedPhone(t *testing.T, id int64) string {
+	t.Helper()
+	var phone string
+	if err := testDB.Raw("SELECT phone FROM patients WHERE id = ?", id).Scan(&phone).Error; err != nil {
+		t.Fatalf("raw select failed: %v", err)
+	}
+	return phone
+}
+
+func TestFieldEncryption(t *testing.T) {
+	cleanTables(t, "patients")
+	repo := db.NewRepo[Patient, int64]()
+	c := &Patient{Name: "alice", Phone: "13800000001", IDCard: "110101199001011234"}
+	id, err := repo.Create(c)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if c.Phone != "13800000001" {
+		t.Fatalf("entity should keep plaintext after create: %q", c.Phone)
+	}
+	if stored := storedPhone(t, id); !strings.HasPrefix(stored, "enc:k1:") || strings.Contains(stored, "13800000001") {
+		t.Fatalf("phone should be stored encrypted: %q", stored)
+	}
+	got, err := repo.GetByID(id)
+	if err != nil || got == nil || got.Phone != "13800000001" || got.IDCard != "110101199001011234" {
+		t.Fatalf("get should decrypt: %+v %v", got, err)
+	}
+
+	// 等值查询通过盲索引匹配，其它比较与无盲索引的字段拒绝执行
+	if got, err := repo.Eq("phone", "13800000001").Get(); err != nil || got == nil || got.ID != id {
+		t.Fatalf("eq on encrypted column should match: %+v %v", got, err)
+	}
+	if list, err := repo.In("phone", []string{"13800000001", "13800000009"}).List(); err != nil || len(list) != 1 {
+		t.Fatalf("in on encrypted column should match: %+v %v", list, err)
+	}
+	if _, err := repo.Like("phone", "138%").List(); err == nil {
+		t.Fatal("like on encrypted column should fail")
+	}
+	if _, err := repo.Eq("id_card", "110101199001011234").Get(); err == nil {
+		t.Fatal("eq without blind index column should fail")
+	}
+
+	// Update 的赋值同样加密并更新盲索引
+	if _, err := repo.Eq("id", id).Set("phone", "13800000002").Update(); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if n, _ := repo.Eq("phone", "13800000002").Count(); n != 1 {
+		t.Fatal("blind index should follow updated phone")
+	}
+	page, err := repo.Eq("name", "alice").PageT()
+	if err != nil || len(page.Result) != 1 || page.Result[0].Phone != "13800000002" {
+		t.Fatalf("page should decrypt: %+v %v", page, err)
+	}
+	got = &page.Result[0]
+	got.IDCard = "110101199001015678"
+	if _, err := repo.UpdateFull(got); err != nil || got.IDCard != "110101199001015678" {
+		t.Fatalf("update full should keep plaintext on the entity: %+v %v", got, err)
+	}
+	if got, _ := repo.GetByID(id); got == nil || got.IDCard != "110101199001015678" || got.Phone != "13800000002" {
+		t.Fatalf("update full should encrypt all fields: %+v", got)
+	}
+
+	// 工作单元的批量更新同样加密并更新盲索引
+	got.Phone = "13800000003"
+	u := db.NewUnitOfWork()
+	db.RegisterDirty(u, repo, got)
+	if err := u.Commit(context.Background()); err != nil || got.Phone != "13800000003" {
+		t.Fatalf("unit of work commit failed: %+v %v", got, err)
+	}
+	if stored := storedPhone(t, id); !strings.HasPrefix(stored, "enc:k1:") {
+		t.Fatalf("bulk update should store the phone encrypted: %q", stored)
+	}
+	if n, _ := repo.Eq("phone", "13800000003").Count(); n != 1 {
+		t.Fatal("blind index should follow bulk updated phone")
+	}
+
+	// 密钥轮换：历史数据仍可解密，Reencrypt 以新密钥重新加密并迁移明文存量数据
+	if _, err := repo.Exec("INSERT INTO patients (name, phone, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		"legacy", "13900000000", time.Now(), time.Now()); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	patientKeys.Current = "k2"
+	defer func() { patientKeys.Current = "k1" }()
+	if got, _ := repo.GetByID(id); got == nil || got.Phone != "13800000003" {
+		t.Fatalf("data encrypted with the old key should still decrypt: %+v", got)
+	}
+	n, err := db.Reencrypt(repo, 1)
+	if err != nil || n != 2 {
+		t.Fatalf("reencrypt should update 2 rows: %d %v", n, err)
+	}
+	if stored := storedPhone(t, id); !strings.HasPrefix(stored, "enc:k2:") {
+		t.Fatalf("phone should be reencrypted with k2: %q", stored)
+	}
+	legacy, err := repo.Eq("phone", "13900000000").Get()
+	if err != nil || legacy == nil || legacy.Name != "legacy" {
+		t.Fatalf("reencrypted legacy row should be matched by blind index: %+v %v", legacy, err)
+	}
+	if n, err := db.Reencrypt(repo, 10); err != nil || n != 0 {
+		t.Fatalf("nothing left to reencrypt: %d %v", n, err)
+	}
+}
+
+var memberOutbox = func() *db.Outbox {
+	o := db.NewOutbox()
+	db.Record[Member, int64](o, "member.changed", db.OpCreate, db.OpUpdateFull)
+	return o
+}()
+
+type Member struct {
+	db.ModelI64
+	Name      string
+	Phone     string `dubhe:"encrypt"`
+	PhoneBidx string `gorm:"size:64;index"`
+}
+
+func (Member) TableName() string { return "members" }
+func (Member) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Encryption: patientKeys, Outbox: memberOutbox}
+}
+
+func TestEncryptedOutbox(t *testing.T) {
+	cleanTables(t, "members", "outbox")
+	repo := db.NewRepo[Member, int64]()
+	m := &Member{Name: "bob", Phone: "13700000001"}
+	if _, err := repo.Create(m); err != nil || m.Phone != "13700000001" {
+		t.Fatalf("create failed: %+v %v", m, err)
+	}
+	m.Phone = "13700000002"
+	if _, err := repo.UpdateFull(m); err != nil || m.Phone != "13700000002" {
+		t.Fatalf("update full failed: %+v %v", m, err)
+	}
+
+	// 发件箱消息中的加密字段以掩码代替，不含明文、密文与盲索引
+	var msgs []db.OutboxMessage
+	testDB.Where("topic = ?", "member.changed").Order("id").Find(&msgs)
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 outbox messages, got %d", len(msgs))
+	}
+	for _, msg := range msgs {
+		if strings.Contains(msg.Payload, "137000000") || strings.Contains(msg.Payload, "enc:") {
+			t.Fatalf("payload should not carry the phone: %s", msg.Payload)
+		}
+		var e db.Event[Member, int64]
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil || len(e.Entities) != 1 ||
+			e.Entities[0].Phone != "******" || e.Entities[0].PhoneBidx != "" || e.Entities[0].Name != "bob" {
+			t.Fatalf("unexpected payload: %+v %v", e, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Delivery 领域事件的投递方式
+type Delivery int
+
+const (
+	// DeliverSync 写操作返回前同步调用，处理器返回错误时写操作返回该错误（处于事务中时随事务回滚）
+	DeliverSync Delivery = iota
+	// DeliverAsync 写操作完成后在新协程中调用
+	DeliverAsync
+	// DeliverAfterCommit 所在事务提交后调用，回滚时丢弃；不在事务中时写操作完成后立即调用
+	DeliverAfterCommit
+)
+
+// Event 仓储写操作产生的领域事件。Save 按实际执行的分支产生 OpCreate 或 OpUpdateFull 事件，
+// 分表 Repo 每张命中的分表各产生一个事件
+type Event[T IModel[K], K Key] struct {
+	Key      string    `json:"key"`                // Repo 缓存键（数据源 + 表名）
+	Table    string    `json:"table"`              // 实际写入的表名
+	Op       OpKind    `json:"op"`                 // OpCreate / OpCreateBatch / OpUpdate / OpUpdateFull / OpDel
+	IDs      []K       `json:"ids"`                // 受影响记录的主键，Update/Del 为执行前命中的主键
+	Entities []T       `json:"entities,omitempty"` // Create/CreateBatch/UpdateFull 写入的实体，加密字段以掩码代替
+	Changed  []string  `json:"changed,omitempty"`  // Update 通过 Set 赋值的字段
+	Actor    string    `json:"actor,omitempty"`    // 操作人
+	At       time.Time `json:"at"`
+}
+
+// Dispatcher 领域事件分发器，通过 RepoCfg.Events 挂到 Repo 上，按模型类型订阅
+type Dispatcher struct {
+	onError func(ctx context.Context, err error)
+
+	mu   sync.RWMutex
+	subs map[reflect.Type][]subscription
+}
+
+type subscription struct {
+	delivery Delivery
+	ops      []OpKind
+	handle   func(ctx context.Context, e any) error
+}
+
+// NewDispatcher 创建事件分发器，onError 接收异步与提交后投递的处理器错误（含 panic），可为 nil
+func NewDispatcher(onError func(ctx context.Context, err error)) *Dispatcher {
+	return &Dispatcher{onError: onError, subs: make(map[reflect.Type][]subscription)}
+}
+
+// Subscribe 订阅模型 T 的领域事件，ops 为空时订阅全部写操作
+func Subscribe[T IModel[K], K Key](d *Dispatcher, delivery Delivery, handler func(ctx context.Context, e Event[T, K]) error, ops ...OpKind) {
+	typ := reflect.TypeFor[T]()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subs[typ] = append(d.subs[typ], subscription{
+		delivery: delivery,
+		ops:      ops,
+		handle: func(ctx context.Context, e any) error {
+			return handler(ctx, e.(Event[T, K]))
+		},
+	})
+}
+
+// subscribers 订阅了 typ 模型 op 操作的处理器
+func (d *Dispatcher) subscribers(typ reflect.Type, op OpKind) []subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var res []subscription
+	for _, s := range d.subs[typ] {
+		if len(s.ops) == 0 || slices.Contains(s.ops, op) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// run 调用处理器，错误与 panic 交给 onError
+func (d *Dispatcher) run(ctx context.Context, s subscription, e any) {
+	defer func() {
+		if p := recover(); p != nil {
+			d.report(ctx, fmt.Errorf("event handler panic: %v", p))
+		}
+	}()
+	if err := s.handle(ctx, e); err != nil {
+		d.report(ctx, err)
+	}
+}
+
+func (d *Dispatcher) report(ctx context.Context, err error) {
+	if d.onError != nil {
+		d.onError(ctx, err)
+	}
+}
+
+// emit 写操作成功后写入变更记录与发件箱，并按订阅的投递方式分发事件
+func (r *Repo[T, K]) emit(op OpKind, ids []K, entities []*T, changed []string) error {
+	typ := reflect.TypeFor[T]()
+	d := r.cfg.Events
+	var subs []subscription
+	if d != nil {
+		subs = d.subscribers(typ, op)
+	}
+	var topics []string
+	if r.cfg.Outbox != nil {
+		topics = r.cfg.Outbox.topics(typ, op)
+	}
+	if r.cfg.ChangeLog == CaptureHooks {
+		if err := r.writeChanges(op, ids); err != nil {
+			return err
+		}
+	}
+	if len(subs) == 0 && len(topics) == 0 {
+		return nil
+	}
+	table := r.table
+	if r.shardTable != "" {
+		table = r.shardTable
+	}
+	e := Event[T, K]{Key: r.key, Table: table, Op: op, IDs: ids, Changed: changed, Actor: r.actor(), At: time.Now()}
+	for _, t := range entities {
+		if t != nil {
+			e.Entities = append(e.Entities, *t)
+		}
+	}
+	if err := r.maskEncrypted(e.Entities); err != nil {
+		return err
+	}
+	if len(topics) != 0 {
+		// 写操作已在 inWriteTx 开启或复用的事务中
+		db, err := r.conn()
+		if err != nil {
+			return err
+		}
+		if err := r.cfg.Outbox.write(db, topics, outboxKey(ids), e); err != nil {
+			return err
+		}
+	}
+	ctx := r.context()
+	for _, s := range subs {
+		switch s.delivery {
+		case DeliverSync:
+			if err := s.handle(ctx, e); err != nil {
+				return err
+			}
+		case DeliverAsync:
+			go d.run(ctx, s, e)
+		case DeliverAfterCommit:
+			if r.hooks != nil {
+				r.hooks.onCommit(func() { d.run(ctx, s, e) })
+			} else {
+				d.run(ctx, s, e)
+			}
+		}
+	}
+	return nil
+}
+
+// setFields Update 通过 Set 赋值的字段
+func (r *Repo[T, K]) setFields() []string {
+	fields := make([]string, len(r.match.Sets))
+	for i, s := range r.match.Sets {
+		fields[i] = s.Field
+	}
+	return fields
+}
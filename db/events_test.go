@@ -0,0 +1,106 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+var shipmentEvents = db.NewDispatcher(nil)
+
+type Shipment struct {
+	db.ModelI64
+	Status string
+}
+
+func (Shipment) TableName() string { return "shipments" }
+func (Shipment) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Events: shipmentEvents}
+}
+
+func TestDomainEvents(t *testing.T) {
+	var sync []db.Event[Shipment, int64]
+	db.Subscribe(shipmentEvents, db.DeliverSync, func(ctx context.Context, e db.Event[Shipment, int64]) error {
+		sync = append(sync, e)
+		if len(e.Entities) != 0 && e.Entities[0].Status == "rejected" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	var committed []db.OpKind
+	db.Subscribe(shipmentEvents, db.DeliverAfterCommit, func(ctx context.Context, e db.Event[Shipment, int64]) error {
+		committed = append(committed, e.Op)
+		return nil
+	})
+	async := make(chan db.Event[Shipment, int64], 10)
+	db.Subscribe(shipmentEvents, db.DeliverAsync, func(ctx context.Context, e db.Event[Shipment, int64]) error {
+		async <- e
+		return nil
+	}, db.OpDel)
+
+	repo := db.NewRepo[Shipment, int64]()
+	id, err := repo.Save(&Shipment{Status: "new"})
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if len(sync) != 1 || sync[0].Op != db.OpCreate || sync[0].IDs[0] != id || sync[0].Entities[0].ID != id {
+		t.Fatalf("unexpected create event: %+v", sync)
+	}
+	if _, err := repo.Eq("id", id).Set("status", "sent").Update(); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if e := sync[1]; e.Op != db.OpUpdate || !slices.Equal(e.IDs, []int64{id}) || !slices.Equal(e.Changed, []string{"status"}) {
+		t.Fatalf("unexpected update event: %+v", e)
+	}
+	// 未命中记录的更新不产生事件
+	if _, err := repo.Eq("id", -1).Set("status", "sent").Update(); err != nil || len(sync) != 2 {
+		t.Fatalf("no-op update should not emit: %d %v", len(sync), err)
+	}
+
+	// 同步处理器出错时写操作返回错误，事务中随之回滚
+	tx := repo.Begin()
+	if _, err := tx.Create(&Shipment{Status: "rejected"}); err == nil {
+		t.Fatal("sync handler error should fail the write")
+	}
+	_ = tx.Rollback()
+	if n, _ := repo.Eq("status", "rejected").Count(); n != 0 {
+		t.Fatal("rejected shipment should be rolled back")
+	}
+
+	// 提交后投递：回滚丢弃，提交后按顺序投递
+	committed = nil
+	tx = repo.Begin()
+	if _, err := tx.Create(&Shipment{Status: "draft"}); err != nil {
+		t.Fatalf("create in tx failed: %v", err)
+	}
+	_ = tx.Rollback()
+	tx = repo.Begin()
+	if _, err := tx.Save(&Shipment{ModelI64: db.ModelI64{ID: id}, Status: "done"}); err != nil {
+		t.Fatalf("save in tx failed: %v", err)
+	}
+	if len(committed) != 0 {
+		t.Fatal("after-commit handler should wait for commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if !slices.Equal(committed, []db.OpKind{db.OpUpdateFull}) {
+		t.Fatalf("unexpected after-commit events: %v", committed)
+	}
+
+	if _, err := repo.Eq("id", id).Del(); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+	select {
+	case e := <-async:
+		if e.Op != db.OpDel || !slices.Equal(e.IDs, []int64{id}) {
+			t.Fatalf("unexpected async event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("async event not delivered")
+	}
+}
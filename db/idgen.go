@@ -0,0 +1,268 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IDGenerator 主键生成器，Create/CreateBatch/Save 新增时为零值主键赋值
+type IDGenerator[K Key] interface {
+	NextID() (K, error)
+}
+
+// IDGeneratorFunc 函数形式的 IDGenerator
+type IDGeneratorFunc[K Key] func() (K, error)
+
+func (f IDGeneratorFunc[K]) NextID() (K, error) {
+	return f()
+}
+
+// region String ID Models
+
+// ModelUUID 字符串 UUID 主键的基础模型，需配合 UUIDv4/UUIDv7 生成器
+type ModelUUID struct {
+	ID        string         `gorm:"primaryKey;size:36" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (m ModelUUID) GetID() string {
+	return m.ID
+}
+
+func (m ModelUUID) IsNil() bool {
+	return m.ID == ""
+}
+
+// ModelULID 字符串 ULID 主键的基础模型，需配合 ULID 生成器
+type ModelULID struct {
+	ID        string         `gorm:"primaryKey;size:26" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (m ModelULID) GetID() string {
+	return m.ID
+}
+
+func (m ModelULID) IsNil() bool {
+	return m.ID == ""
+}
+
+// endregion String ID Models
+
+// region Snowflake
+
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// snowflakeEpoch 时间戳起点 2020-01-01 UTC
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+// Snowflake 雪花算法 int64 主键生成器：41 位毫秒时间戳 + 10 位节点 + 12 位序列
+type Snowflake struct {
+	node int64
+
+	mu   sync.Mutex
+	last int64
+	seq  int64
+}
+
+// NewSnowflake 创建雪花算法生成器，node 取值 0-1023，多实例部署时需各不相同
+func NewSnowflake(node int64) *Snowflake {
+	if node < 0 || node > snowflakeMaxNode {
+		panic(fmt.Sprintf("snowflake node must be between 0 and %d", snowflakeMaxNode))
+	}
+	return &Snowflake{node: node}
+}
+
+func (s *Snowflake) NextID() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UnixMilli()
+	if now < s.last {
+		// 时钟回拨时沿用上次时间戳，依靠序列保证递增
+		now = s.last
+	}
+	if now == s.last {
+		s.seq = (s.seq + 1) & snowflakeMaxSeq
+		if s.seq == 0 {
+			// 序列用尽，等待下一毫秒
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = now
+	return (now-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) | s.node<<snowflakeSeqBits | s.seq, nil
+}
+
+// endregion Snowflake
+
+// region UUID / ULID
+
+// UUIDv4 随机 UUID 生成器
+func UUIDv4() IDGenerator[string] {
+	return IDGeneratorFunc[string](func() (string, error) {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", err
+		}
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return formatUUID(b), nil
+	})
+}
+
+// UUIDv7 按时间有序的 UUID 生成器（RFC 9562），适合作为聚簇索引主键
+func UUIDv7() IDGenerator[string] {
+	return IDGeneratorFunc[string](func() (string, error) {
+		var b [16]byte
+		if _, err := rand.Read(b[6:]); err != nil {
+			return "", err
+		}
+		ms := uint64(time.Now().UnixMilli())
+		b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+		b[6] = b[6]&0x0f | 0x70
+		b[8] = b[8]&0x3f | 0x80
+		return formatUUID(b), nil
+	})
+}
+
+func formatUUID(b [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator 单调 ULID：同一毫秒内随机部分递增，保证生成顺序与字典序一致
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	lastRnd [10]byte
+}
+
+// ULID 按时间有序的 ULID 生成器（26 位 Crockford Base32）
+func ULID() IDGenerator[string] {
+	return &ulidGenerator{}
+}
+
+func (g *ulidGenerator) NextID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		// 随机部分加一，溢出时进位到时间戳
+		i := len(g.lastRnd) - 1
+		for ; i >= 0; i-- {
+			g.lastRnd[i]++
+			if g.lastRnd[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			ms++
+		}
+	} else if _, err := rand.Read(g.lastRnd[:]); err != nil {
+		return "", err
+	}
+	g.lastMs = ms
+
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], g.lastRnd[:])
+	return encodeULID(b), nil
+}
+
+// encodeULID 将 128 位按 5 位一组编码为 26 个字符（首字符只含 3 位）
+func encodeULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// endregion UUID / ULID
+
+// idGeneratorOf 校验 RepoCfg.IDGenerator 的主键类型
+func idGeneratorOf[K Key](key string, cfg RepoCfg) IDGenerator[K] {
+	if cfg.IDGenerator == nil {
+		return nil
+	}
+	gen, ok := cfg.IDGenerator.(IDGenerator[K])
+	if !ok {
+		var k K
+		panic(fmt.Sprintf("%s: IDGenerator %T does not generate %T keys", key, cfg.IDGenerator, k))
+	}
+	return gen
+}
+
+// generateIDs 为零值主键的实体生成主键
+func (r *Repo[T, K]) generateIDs(ts ...*T) error {
+	if r.idGen == nil || len(ts) == 0 {
+		return nil
+	}
+	db, err := r.conn()
+	if err != nil {
+		return err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	field := sch.PrioritizedPrimaryField
+	if field == nil {
+		return fmt.Errorf("%s: IDGenerator requires a single primary key", r.key)
+	}
+	ctx := r.context()
+	for _, t := range ts {
+		if t == nil {
+			continue
+		}
+		rv := reflect.ValueOf(t).Elem()
+		if _, zero := field.ValueOf(ctx, rv); !zero {
+			continue
+		}
+		id, err := r.idGen.NextID()
+		if err != nil {
+			return err
+		}
+		if err := field.Set(ctx, rv, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package db_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+type Device struct {
+	db.ModelUUID
+	Name string
+}
+
+func (Device) TableName() string { return "devices" }
+func (Device) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, IDGenerator: db.UUIDv7()}
+}
+
+type Metric struct {
+	db.ModelI64
+	Name string
+}
+
+func (Metric) TableName() string { return "metrics" }
+func (Metric) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, IDGenerator: db.NewSnowflake(7)}
+}
+
+type Coupon struct {
+	db.ModelGen[string]
+	Code string
+}
+
+func (Coupon) TableName() string { return "coupons" }
+func (Coupon) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, IDGenerator: db.ULID()}
+}
+
+type autoIncCoupon struct {
+	db.ModelT[int64]
+	Code string
+}
+
+// TestStringKeyMigration 字符串主键模型的迁移：ModelGen 不带自增，MySQL 的建表语句不含 AUTO_INCREMENT
+func TestStringKeyMigration(t *testing.T) {
+	cleanTables(t, "coupons")
+	coupons := db.NewRepo[Coupon, string]()
+	id, err := coupons.Create(&Coupon{Code: "c1"})
+	if err != nil || len(id) != 26 {
+		t.Fatalf("create should generate ulid: %v, %q", err, id)
+	}
+	if c, _ := coupons.GetByID(id); c == nil || c.Code != "c1" {
+		t.Fatalf("get by string id failed: %+v", c)
+	}
+
+	mysqlDB, err := gorm.Open(mysql.New(mysql.Config{DSN: "u:p@tcp(127.0.0.1:1)/x", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open dry run mysql failed: %v", err)
+	}
+	idType := func(model any) string {
+		stmt := &gorm.Statement{DB: mysqlDB}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		return mysqlDB.Migrator().(interface {
+			FullDataTypeOf(field *schema.Field) clause.Expr
+		}).FullDataTypeOf(stmt.Schema.LookUpField("id")).SQL
+	}
+	if typ := idType(&Coupon{}); strings.Contains(typ, "AUTO_INCREMENT") || !strings.Contains(typ, "varchar") {
+		t.Fatalf("string key should be a plain varchar column: %s", typ)
+	}
+	if typ := idType(&autoIncCoupon{}); !strings.Contains(typ, "AUTO_INCREMENT") {
+		t.Fatalf("ModelT key should auto increment: %s", typ)
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([47])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	v4, _ := db.UUIDv4().NextID()
+	v7, _ := db.UUIDv7().NextID()
+	if m := uuidRe.FindStringSubmatch(v4); m == nil || m[1] != "4" {
+		t.Fatalf("invalid uuid v4: %s", v4)
+	}
+	if m := uuidRe.FindStringSubmatch(v7); m == nil || m[1] != "7" {
+		t.Fatalf("invalid uuid v7: %s", v7)
+	}
+
+	ulid := db.ULID()
+	sf := db.NewSnowflake(1)
+	var lastULID string
+	var lastSF int64
+	for range 10000 {
+		u, _ := ulid.NextID()
+		if len(u) != 26 || u <= lastULID {
+			t.Fatalf("ulid should be 26 chars and monotonic: %s after %s", u, lastULID)
+		}
+		s, _ := sf.NextID()
+		if s <= lastSF {
+			t.Fatalf("snowflake should be monotonic: %d after %d", s, lastSF)
+		}
+		lastULID, lastSF = u, s
+	}
+}
+
+func TestRepoIDGenerator(t *testing.T) {
+	cleanTables(t, "devices", "metrics")
+	devices := db.NewRepo[Device, string]()
+	id, err := devices.Save(&Device{Name: "d1"})
+	if err != nil || len(id) != 36 {
+		t.Fatalf("save should generate uuid: %v, %q", err, id)
+	}
+	batch := []*Device{{Name: "d2"}, {Name: "d3", ModelUUID: db.ModelUUID{ID: "fixed"}}}
+	if _, err := devices.CreateBatch(batch); err != nil || batch[0].ID == "" || batch[1].ID != "fixed" {
+		t.Fatalf("create batch should fill zero ids only: %v, %+v", err, batch)
+	}
+	if d, _ := devices.GetByID(id); d == nil || d.Name != "d1" {
+		t.Fatalf("get by generated id failed: %+v", d)
+	}
+
+	metrics := db.NewRepo[Metric, int64]()
+	mid, err := metrics.Create(&Metric{Name: "m"})
+	if err != nil || mid < 1<<22 {
+		t.Fatalf("create should use snowflake id: %v, %d", err, mid)
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 各驱动单条语句的占位符上限
+var placeholderLimits = map[string]int{
+	"mysql":  65535,
+	"sqlite": 32766,
+}
+
+// placeholderReserve 为作用域、租户等附加条件预留的占位符数量
+const placeholderReserve = 100
+
+// MissingIDsError ReportMissing 开启时，GetByIDs/ListByIDs 未找到部分 ID 返回的错误
+type MissingIDsError[K Key] struct {
+	Key string // Repo 缓存键（数据源 + 表名）
+	IDs []K    // 未找到的 ID，按传入顺序
+}
+
+func (e *MissingIDsError[K]) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i, id := range e.IDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	return fmt.Sprintf("%s: ids not found: %s", e.Key, strings.Join(ids, ", "))
+}
+
+// ReportMissing GetByIDs/ListByIDs 未找到部分 ID 时返回 *MissingIDsError（同时返回已找到的记录），返回新的 Repo 实例
+func (r *Repo[T, K]) ReportMissing() IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.reportMissing = true
+	return newRepo
+}
+
+// GetByIDs 根据ID批量获取记录，返回 ID 到记录的映射，不存在的 ID 不在结果中
+func (r *Repo[T, K]) GetByIDs(ids []K) (map[K]*T, error) {
+	res, _, err := r.byIDs(ids)
+	return res, err
+}
+
+// ListByIDs 根据ID批量获取记录，按传入 ID 的顺序返回（重复 ID 只返回一次），不存在的 ID 跳过
+func (r *Repo[T, K]) ListByIDs(ids []K) ([]T, error) {
+	res, order, err := r.byIDs(ids)
+	list := make([]T, 0, len(res))
+	for _, id := range order {
+		if t, ok := res[id]; ok {
+			list = append(list, *t)
+		}
+	}
+	return list, err
+}
+
+// byIDs 去重后先读实体缓存，未命中的按驱动占位符上限分批 IN 查询；order 为去重后的 ID 顺序。
+// 查回的记录按规范化后的主键（见 normalizeKey）对应到调用方传入的 ID，结果以传入的 ID 为键
+func (r *Repo[T, K]) byIDs(ids []K) (map[K]*T, []K, error) {
+	res := make(map[K]*T, len(ids))
+	order := make([]K, 0, len(ids))
+	seen := make(map[K]K, len(ids)) // 规范化主键 -> 首次传入的 ID
+	cache, cached := r.readCache()
+	var missing []K
+	for _, id := range ids {
+		norm := normalizeKey(id)
+		if _, ok := seen[norm]; ok {
+			continue
+		}
+		seen[norm] = id
+		order = append(order, id)
+		if cached {
+			if v, ok := cache.Get(r.cacheKey(id)); ok {
+				t := v.(T)
+				res[id] = &t
+				continue
+			}
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) != 0 {
+		size, err := r.idChunkSize()
+		if err != nil {
+			return nil, nil, err
+		}
+		gen := r.cacheGen.Load()
+		var repo IRepo[T, K] = r
+		if cached {
+			repo = r.Primary()
+		}
+		for start := 0; start < len(missing); start += size {
+			field, values, err := r.keysIn(missing[start:min(start+size, len(missing))])
+			if err != nil {
+				return nil, nil, err
+			}
+			list, err := repo.In(field, values).List()
+			if err != nil {
+				return nil, nil, err
+			}
+			fill := cached && r.cacheGen.Load() == gen
+			for i := range list {
+				id, ok := seen[normalizeKey(list[i].GetID())]
+				if !ok {
+					continue
+				}
+				res[id] = &list[i]
+				if fill {
+					cache.Set(r.cacheKey(id), list[i], 0)
+				}
+			}
+		}
+	}
+	if r.reportMissing && len(res) != len(order) {
+		e := &MissingIDsError[K]{Key: r.key}
+		for _, id := range order {
+			if _, ok := res[id]; !ok {
+				e.IDs = append(e.IDs, id)
+			}
+		}
+		return res, order, e
+	}
+	return res, order, nil
+}
+
+// idChunkSize 单次 IN 查询的 ID 数量（复合主键每个 ID 占多个占位符），未知驱动按 mysql 上限处理
+func (r *Repo[T, K]) idChunkSize() (int, error) {
+	db, err := r.conn()
+	if err != nil {
+		return 0, err
+	}
+	cols, err := r.keyColumns()
+	if err != nil {
+		return 0, err
+	}
+	limit, ok := placeholderLimits[db.Dialector.Name()]
+	if !ok {
+		limit = placeholderLimits["mysql"]
+	}
+	return (limit - placeholderReserve - len(r.match.Clauses)) / len(cols), nil
+}
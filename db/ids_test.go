@@ -0,0 +1,51 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+type Tag struct {
+	db.ModelI64
+	Title string
+}
+
+func (Tag) TableName() string { return "tags" }
+func (Tag) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true}
+}
+
+func TestListByIDs(t *testing.T) {
+	repo := db.NewRepo[Tag, int64]()
+	var ids []int64
+	for _, title := range []string{"a", "b", "c"} {
+		id, err := repo.Create(&Tag{Title: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	list, err := repo.ListByIDs([]int64{ids[2], ids[0], ids[2], ids[1]})
+	if err != nil || len(list) != 3 || list[0].Title != "c" || list[1].Title != "a" || list[2].Title != "b" {
+		t.Fatalf("list by ids should keep input order: %v, %+v", err, list)
+	}
+
+	// 超过 sqlite 占位符上限时分批查询
+	many := make([]int64, 40000)
+	for i := range many {
+		many[i] = int64(i + 1)
+	}
+	m, err := repo.GetByIDs(many)
+	if err != nil || len(m) < 3 {
+		t.Fatalf("chunked get by ids failed: %v, %d", err, len(m))
+	}
+
+	m, err = repo.ReportMissing().GetByIDs([]int64{ids[0], -1, -2})
+	var missing *db.MissingIDsError[int64]
+	if !errors.As(err, &missing) || len(missing.IDs) != 2 || missing.IDs[0] != -1 || len(m) != 1 {
+		t.Fatalf("expected missing ids error, got %v, %+v", err, m)
+	}
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+)
+
+// OpKind Repo 操作类型
+type OpKind string
+
+const (
+	OpCreate      OpKind = "create"
+	OpCreateBatch OpKind = "create_batch"
+	OpSave        OpKind = "save"
+	OpUpdate      OpKind = "update"
+	OpUpdateFull  OpKind = "update_full"
+	OpDel         OpKind = "del"
+	OpGet         OpKind = "get"
+	OpList        OpKind = "list"
+	OpPage        OpKind = "page" // Page 与 PageT
+)
+
+// Operation 拦截器看到的一次 Repo 操作
+type Operation interface {
+	// Key Repo 缓存键（数据源 + 表名）
+	Key() string
+	// Kind 操作类型
+	Kind() OpKind
+	// Match 本次操作的条件、排序与赋值，修改后对本次操作生效
+	Match() *clause.Match
+	// Entities Create/CreateBatch/Save/UpdateFull 的实体指针（*T），可原地修改；其它操作为空
+	Entities() []any
+	// Result 操作结果：Create/Save 为主键，CreateBatch/Update/UpdateFull/Del 为影响行数，
+	// Get 为 *T，List 为 []T，Page 为 *Page 或 *PageT[T]；next 返回前为零值
+	Result() any
+	// SetResult 替换操作结果，用于短路（不调用 next）时返回自定义结果
+	SetResult(any) error
+}
+
+// Interceptor 拦截器：包裹 Repo 操作，可在 next 前后执行逻辑、修改 Match 与实体，
+// 或不调用 next 直接返回以短路操作
+type Interceptor func(ctx context.Context, op Operation, next func() error) error
+
+type operation[T any] struct {
+	key      string
+	kind     OpKind
+	match    *clause.Match
+	entities []*T
+	result   any // 指向结果变量的指针
+}
+
+func (o *operation[T]) Key() string          { return o.key }
+func (o *operation[T]) Kind() OpKind         { return o.kind }
+func (o *operation[T]) Match() *clause.Match { return o.match }
+
+func (o *operation[T]) Entities() []any {
+	res := make([]any, len(o.entities))
+	for i, t := range o.entities {
+		res[i] = t
+	}
+	return res
+}
+
+func (o *operation[T]) Result() any {
+	return reflect.ValueOf(o.result).Elem().Interface()
+}
+
+func (o *operation[T]) SetResult(v any) error {
+	dst := reflect.ValueOf(o.result).Elem()
+	if v == nil {
+		dst.SetZero()
+		return nil
+	}
+	val := reflect.ValueOf(v)
+	if !val.Type().AssignableTo(dst.Type()) {
+		return fmt.Errorf("%s: %s result must be %s, got %T", o.key, o.kind, dst.Type(), v)
+	}
+	dst.Set(val)
+	return nil
+}
+
+// intercept 按 RepoCfg.Interceptors 的顺序（第一个在最外层）包裹 run；
+// run 收到的副本已标记为拦截中，内部嵌套调用（如 Save 调用 Create）不再重复拦截
+func (r *Repo[T, K]) intercept(kind OpKind, entities []*T, result any, run func(*Repo[T, K]) error) error {
+	interceptors := r.cfg.Interceptors
+	if len(interceptors) == 0 || r.intercepted {
+		return run(r)
+	}
+	c := r.cloneInternal()
+	c.intercepted = true
+	op := &operation[T]{key: r.key, kind: kind, match: &c.match, entities: entities, result: result}
+	ctx := r.context()
+	next := func() error { return run(c) }
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func() error { return interceptor(ctx, op, inner) }
+	}
+	return next()
+}
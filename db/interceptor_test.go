@@ -0,0 +1,89 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+var interceptedOps []db.OpKind
+
+type Widget struct {
+	db.ModelI64
+	Name   string
+	Hidden bool
+}
+
+func (Widget) TableName() string { return "widgets" }
+func (Widget) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Interceptors: []db.Interceptor{
+		// 记录操作
+		func(ctx context.Context, op db.Operation, next func() error) error {
+			interceptedOps = append(interceptedOps, op.Kind())
+			return next()
+		},
+		// 校验与修改实体
+		func(ctx context.Context, op db.Operation, next func() error) error {
+			for _, e := range op.Entities() {
+				w := e.(*Widget)
+				if w.Name == "" {
+					return errors.New("name required")
+				}
+				w.Name = "w-" + w.Name
+			}
+			return next()
+		},
+		// 修改 Match：查询默认排除隐藏记录；短路 Get
+		func(ctx context.Context, op db.Operation, next func() error) error {
+			switch op.Kind() {
+			case db.OpList, db.OpPage:
+				op.Match().Eq("hidden", false)
+			case db.OpGet:
+				if len(op.Match().Clauses) == 0 {
+					return op.SetResult(&Widget{Name: "default"})
+				}
+			}
+			return next()
+		},
+	}}
+}
+
+func TestInterceptors(t *testing.T) {
+	cleanTables(t, "widgets")
+	t.Cleanup(func() { interceptedOps = nil })
+	repo := db.NewRepo[Widget, int64]()
+	if _, err := repo.Create(&Widget{}); err == nil || err.Error() != "name required" {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	w := &Widget{Name: "a"}
+	if _, err := repo.Save(w); err != nil || w.Name != "w-a" {
+		t.Fatalf("save failed: %v, %+v", err, w)
+	}
+	_, _ = repo.Create(&Widget{Name: "b", Hidden: true})
+
+	if list, _ := repo.List(); len(list) != 1 || list[0].Name != "w-a" {
+		t.Fatalf("interceptor should hide hidden widgets: %+v", list)
+	}
+	if page, _ := repo.PageT(); page.Total != 1 {
+		t.Fatalf("interceptor should apply to page: %+v", page)
+	}
+	if got, _ := repo.Get(); got == nil || got.Name != "default" {
+		t.Fatalf("get should be short-circuited: %+v", got)
+	}
+	if got, _ := repo.Eq("name", "w-b").Get(); got == nil || !got.Hidden {
+		t.Fatalf("get with condition should query: %+v", got)
+	}
+
+	// Save 内部调用 Create 不重复拦截
+	want := []db.OpKind{db.OpCreate, db.OpSave, db.OpCreate, db.OpList, db.OpPage, db.OpGet, db.OpGet}
+	if len(interceptedOps) != len(want) {
+		t.Fatalf("unexpected ops: %v", interceptedOps)
+	}
+	for i := range want {
+		if interceptedOps[i] != want[i] {
+			t.Fatalf("unexpected ops: %v", interceptedOps)
+		}
+	}
+}
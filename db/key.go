@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// keyColumn 一个主键列及其在主键类型 K 中的取值位置
+type keyColumn struct {
+	column string
+	index  []int // 复合主键结构体中的字段下标，单列主键为空
+}
+
+// value 取主键 id 中该列的值
+func (c keyColumn) value(id any) any {
+	if c.index == nil {
+		return id
+	}
+	return reflect.ValueOf(id).FieldByIndex(c.index).Interface()
+}
+
+// keyColumns 按 GORM schema 解析主键列：单列主键对应 K 本身，
+// 复合主键要求 K 为结构体，按字段名与模型的主键字段一一对应
+func (r *Repo[T, K]) keyColumns() ([]keyColumn, error) {
+	db, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	fields := sch.PrimaryFields
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s: model has no primary key", r.key)
+	}
+	kt := reflect.TypeFor[K]()
+	if len(fields) == 1 {
+		if kt.Kind() != reflect.Struct {
+			return []keyColumn{{column: fields[0].DBName}}, nil
+		}
+		// 单列主键的结构体类型（如 time.Time）本身即主键值
+		if _, ok := kt.FieldByName(fields[0].Name); !ok {
+			return []keyColumn{{column: fields[0].DBName}}, nil
+		}
+	} else if kt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s: composite primary key requires a struct key type, got %s", r.key, kt)
+	}
+	cols := make([]keyColumn, len(fields))
+	for i, field := range fields {
+		sf, ok := kt.FieldByName(field.Name)
+		if !ok {
+			return nil, fmt.Errorf("%s: key type %s has no field %s", r.key, kt, field.Name)
+		}
+		cols[i] = keyColumn{column: field.DBName, index: sf.Index}
+	}
+	return cols, nil
+}
+
+// whereKey 追加按主键定位单条记录的条件，复合主键展开为多个 Eq
+func (r *Repo[T, K]) whereKey(id K) (*Repo[T, K], error) {
+	cols, err := r.keyColumns()
+	if err != nil {
+		return nil, err
+	}
+	newRepo := r.cloneInternal()
+	for _, c := range cols {
+		newRepo.match.Eq(c.column, c.value(id))
+	}
+	return newRepo, nil
+}
+
+// keysIn 批量主键的 clause.Match In 条件：单列主键为 "id", ids；
+// 复合主键为行值比较 "(a, b)"，各行作为一个整体参数传入，由 GORM 展开为 ((?,?),(?,?))
+func (r *Repo[T, K]) keysIn(ids []K) (string, any, error) {
+	cols, err := r.keyColumns()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(cols) == 1 && cols[0].index == nil {
+		return cols[0].column, ids, nil
+	}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.column
+	}
+	rows := make([][]any, len(ids))
+	for i, id := range ids {
+		row := make([]any, len(cols))
+		for j, c := range cols {
+			row[j] = c.value(id)
+		}
+		rows[i] = row
+	}
+	return "(" + strings.Join(names, ", ") + ")", []any{rows}, nil
+}
+
+// pluckKeys 查询 db 条件命中记录的主键
+func (r *Repo[T, K]) pluckKeys(db *gorm.DB) ([]K, error) {
+	cols, err := r.keyColumns()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.column
+	}
+	var rows []T
+	if err := db.Session(&gorm.Session{}).Select(names).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]K, len(rows))
+	for i := range rows {
+		ids[i] = rows[i].GetID()
+	}
+	return ids, nil
+}
+
+// normalizeKey 去除主键（或复合主键字段）中 time.Time 的单调时钟读数并统一为 UTC，
+// 使同一时刻的主键可用 == 比较、%v 格式化结果一致；从库中读回的时间不带单调时钟且时区可能不同
+func normalizeKey[K Key](id K) K {
+	normalizeTimes(reflect.ValueOf(&id).Elem())
+	return id
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func normalizeTimes(v reflect.Value) {
+	if v.Type() == timeType {
+		v.Set(reflect.ValueOf(v.Interface().(time.Time).Round(0).UTC()))
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for i := range v.NumField() {
+		if f := v.Field(i); f.CanSet() {
+			normalizeTimes(f)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+// ReadingKey Reading 的复合主键
+type ReadingKey struct {
+	DeviceID int64
+	Ts       time.Time
+}
+
+type Reading struct {
+	DeviceID int64     `gorm:"primaryKey;autoIncrement:false"`
+	Ts       time.Time `gorm:"primaryKey"`
+	Value    float64
+}
+
+func (Reading) TableName() string { return "readings" }
+func (Reading) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Cache: db.NewLRUCache(100, time.Minute)}
+}
+
+func (r Reading) GetID() ReadingKey { return ReadingKey{DeviceID: r.DeviceID, Ts: r.Ts} }
+func (r Reading) IsNil() bool       { return r.Ts.IsZero() }
+
+// Sku 主键列不叫 id
+type Sku struct {
+	Code string `gorm:"primaryKey;size:32"`
+	Name string
+}
+
+func (Sku) TableName() string      { return "skus" }
+func (Sku) RepoDefine() db.RepoCfg { return db.RepoCfg{DB: testDB, AutoMigrate: true} }
+func (s Sku) GetID() string        { return s.Code }
+func (s Sku) IsNil() bool          { return s.Code == "" }
+
+func TestCompositeKey(t *testing.T) {
+	cleanTables(t, "readings", "skus")
+	repo := db.NewRepo[Reading, ReadingKey]()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	for _, r := range []Reading{
+		{DeviceID: 0, Ts: t0, Value: 1},
+		{DeviceID: 0, Ts: t1, Value: 2},
+		{DeviceID: 1, Ts: t0, Value: 3},
+	} {
+		if _, err := repo.Create(&r); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+
+	got, err := repo.GetByID(ReadingKey{DeviceID: 1, Ts: t0})
+	if err != nil || got == nil || got.Value != 3 {
+		t.Fatalf("get by composite key failed: %+v %v", got, err)
+	}
+
+	// 零值主键列同样参与定位，只更新一行
+	n, err := repo.UpdateFull(&Reading{DeviceID: 0, Ts: t1, Value: 20})
+	if err != nil || n != 1 {
+		t.Fatalf("update full should touch one row: %d %v", n, err)
+	}
+	if _, err := repo.Save(&Reading{DeviceID: 0, Ts: t0, Value: 10}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	keys := []ReadingKey{{DeviceID: 0, Ts: t1}, {DeviceID: 9, Ts: t0}, {DeviceID: 0, Ts: t0}}
+	list, err := repo.ListByIDs(keys)
+	if err != nil || len(list) != 2 || list[0].Value != 20 || list[1].Value != 10 {
+		t.Fatalf("list by composite keys failed: %+v %v", list, err)
+	}
+	// 再次读取走实体缓存
+	m, err := repo.GetByIDs(keys)
+	if err != nil || len(m) != 2 || m[keys[0]].Value != 20 {
+		t.Fatalf("get by composite keys failed: %+v %v", m, err)
+	}
+
+	if _, err := repo.Eq("device_id", 0).Set("value", 0).Update(); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	got, err = repo.GetByID(ReadingKey{DeviceID: 0, Ts: t1})
+	if err != nil || got == nil || got.Value != 0 {
+		t.Fatalf("cache should be invalidated by composite keys: %+v %v", got, err)
+	}
+	if n, err := repo.Eq("device_id", 0).Del(); err != nil || n != 2 {
+		t.Fatalf("del failed: %d %v", n, err)
+	}
+	if got, _ := repo.GetByID(ReadingKey{DeviceID: 0, Ts: t0}); got != nil {
+		t.Fatal("deleted reading should not be cached")
+	}
+
+	// 主键中的 time.Time 带单调时钟与本地时区，仍能对应到查回的记录与缓存
+	now := time.Now()
+	if _, err := repo.Create(&Reading{DeviceID: 2, Ts: now, Value: 5}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	nowKey := ReadingKey{DeviceID: 2, Ts: now}
+	if list, err := repo.ListByIDs([]ReadingKey{nowKey}); err != nil || len(list) != 1 || list[0].Value != 5 {
+		t.Fatalf("list by time key failed: %+v %v", list, err)
+	}
+	for range 2 {
+		if m, err := repo.GetByIDs([]ReadingKey{nowKey}); err != nil || m[nowKey] == nil || m[nowKey].Value != 5 {
+			t.Fatalf("get by time key failed: %+v %v", m, err)
+		}
+	}
+
+	skus := db.NewRepo[Sku, string]()
+	if _, err := skus.Create(&Sku{Code: "A-1", Name: "apple"}); err != nil {
+		t.Fatalf("create sku failed: %v", err)
+	}
+	sku, err := skus.GetByID("A-1")
+	if err != nil || sku == nil || sku.Name != "apple" {
+		t.Fatalf("get by non-id primary key failed: %+v %v", sku, err)
+	}
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db/ds"
+)
+
+// Loader 批量加载器：收集等待窗口内（或显式 Tick 前）请求的 ID，合并为一次按主键的 IN 查询，
+// 再将结果分发给各调用方；上下文携带 WithLoaderCache 时同一请求内的重复 ID 直接复用结果。
+// 批次按上下文中影响查询的值划分：租户、操作人、请求ID、所在事务、全局作用域生成的条件，
+// 以及 KeyBy 指定的值（如拦截器读取的其它上下文值）；查询使用批次内首个调用方上下文中的值，
+// 但不继承其取消与截止时间，单个调用方取消只影响自身的等待
+type Loader[T IModel[K], K Key] struct {
+	repo IRepo[T, K]
+	wait time.Duration
+	key  func(ctx context.Context) string // 附加的批次划分键
+
+	mu      sync.Mutex
+	batches map[string]*loaderBatch[T, K] // 按 batchKey 划分的当前批次
+}
+
+// loaderBatch 一次批量查询，done 关闭后 res/err 可读
+type loaderBatch[T IModel[K], K Key] struct {
+	ctx   context.Context // 首个调用方的上下文，查询时去除取消
+	keys  []K
+	seen  map[K]struct{}
+	timer *time.Timer
+	done  chan struct{}
+	res   map[K]*T
+	err   error
+}
+
+// NewLoader 基于 Repo 创建批量加载器，查询使用 repo 上已设置的条件与调用方的上下文；
+// wait>0 时首个 ID 到达后等待 wait 自动发出查询，wait<=0 时只在调用 Tick 时发出
+func NewLoader[T IModel[K], K Key](repo IRepo[T, K], wait time.Duration) *Loader[T, K] {
+	return &Loader[T, K]{repo: repo, wait: wait}
+}
+
+// KeyBy 追加批次划分键，上下文中拦截器等读取的值不同时不合并查询，返回当前实例；应在使用前设置
+func (l *Loader[T, K]) KeyBy(fn func(ctx context.Context) string) *Loader[T, K] {
+	l.key = fn
+	return l
+}
+
+// Load 加载单条记录，不存在返回 nil；等待期间 ctx 取消时返回 ctx.Err()
+func (l *Loader[T, K]) Load(ctx context.Context, id K) (*T, error) {
+	b := l.enqueue(ctx, id)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if b.err != nil {
+		loaderCacheFrom(ctx).forget(l, id, b)
+		return nil, b.err
+	}
+	return b.res[id], nil
+}
+
+// LoadMany 加载多条记录，按 ids 顺序返回，不存在的位置为 nil
+func (l *Loader[T, K]) LoadMany(ctx context.Context, ids []K) ([]*T, error) {
+	batches := make([]*loaderBatch[T, K], len(ids))
+	for i, id := range ids {
+		batches[i] = l.enqueue(ctx, id)
+	}
+	res := make([]*T, len(ids))
+	for i, b := range batches {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if b.err != nil {
+			loaderCacheFrom(ctx).forget(l, ids[i], b)
+			return nil, b.err
+		}
+		res[i] = b.res[ids[i]]
+	}
+	return res, nil
+}
+
+// Tick 立即发出当前收集到的全部批量查询
+func (l *Loader[T, K]) Tick() {
+	l.mu.Lock()
+	batches := l.batches
+	l.batches = nil
+	l.mu.Unlock()
+	for _, b := range batches {
+		l.run(b)
+	}
+}
+
+// flush 发出指定键的批次（等待窗口到期时调用）
+func (l *Loader[T, K]) flush(key string, b *loaderBatch[T, K]) {
+	l.mu.Lock()
+	if l.batches[key] != b {
+		// 已被 Tick 发出
+		l.mu.Unlock()
+		return
+	}
+	delete(l.batches, key)
+	l.mu.Unlock()
+	l.run(b)
+}
+
+// run 执行批次查询；查询 panic 时作为批次错误返回给各调用方
+func (l *Loader[T, K]) run(b *loaderBatch[T, K]) {
+	defer func() {
+		if p := recover(); p != nil {
+			b.res, b.err = nil, fmt.Errorf("loader query panicked: %v", p)
+		}
+		close(b.done)
+	}()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	ctx := context.WithoutCancel(b.ctx)
+	b.res, b.err = l.repo.WithCtx(&ctx).GetByIDs(b.keys)
+}
+
+// batchKey 上下文所属批次：批次以首个调用方的上下文查询，其中影响查询的值须一致
+func (l *Loader[T, K]) batchKey(ctx context.Context) string {
+	tenant, _ := ds.TenantFromContext(ctx)
+	scopeSql, scopeArgs := l.repo.WithCtx(&ctx).ScopeMatch().WhereSql()
+	key := fmt.Sprintf("%q|%q|%q|%p|%s|%#v", tenant, ActorFrom(ctx), RequestIDFrom(ctx), txBindingFrom(ctx), scopeSql, scopeArgs)
+	if l.key != nil {
+		key += "|" + l.key(ctx)
+	}
+	return key
+}
+
+// enqueue 将 ID 加入当前批次（请求缓存命中时返回已有批次）
+func (l *Loader[T, K]) enqueue(ctx context.Context, id K) *loaderBatch[T, K] {
+	cache := loaderCacheFrom(ctx)
+	if b, ok := cache.get(l, id); ok {
+		return b.(*loaderBatch[T, K])
+	}
+	key := l.batchKey(ctx)
+	l.mu.Lock()
+	b := l.batches[key]
+	if b == nil {
+		b = &loaderBatch[T, K]{ctx: ctx, seen: make(map[K]struct{}), done: make(chan struct{})}
+		if l.batches == nil {
+			l.batches = make(map[string]*loaderBatch[T, K])
+		}
+		l.batches[key] = b
+		if l.wait > 0 {
+			b.timer = time.AfterFunc(l.wait, func() { l.flush(key, b) })
+		}
+	}
+	if _, ok := b.seen[id]; !ok {
+		b.seen[id] = struct{}{}
+		b.keys = append(b.keys, id)
+	}
+	l.mu.Unlock()
+	cache.put(l, id, b)
+	return b
+}
+
+// region Loader Cache
+
+type loaderCacheKey struct{}
+
+// loaderCache 请求级缓存，按 Loader 与 ID 保存所在批次
+type loaderCache struct {
+	mu sync.Mutex
+	m  map[loaderEntryKey]any
+}
+
+type loaderEntryKey struct {
+	loader any
+	id     any
+}
+
+// WithLoaderCache 返回携带请求级加载缓存的上下文，通常在每个请求开始时调用
+func WithLoaderCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loaderCacheKey{}, &loaderCache{m: make(map[loaderEntryKey]any)})
+}
+
+func loaderCacheFrom(ctx context.Context) *loaderCache {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(loaderCacheKey{}).(*loaderCache)
+	return c
+}
+
+func (c *loaderCache) get(loader, id any) (any, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[loaderEntryKey{loader: loader, id: id}]
+	return v, ok
+}
+
+func (c *loaderCache) put(loader, id, batch any) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[loaderEntryKey{loader: loader, id: id}] = batch
+}
+
+// forget 查询失败时移除缓存，后续请求可重试
+func (c *loaderCache) forget(loader, id, batch any) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := loaderEntryKey{loader: loader, id: id}
+	if c.m[key] == batch {
+		delete(c.m, key)
+	}
+}
+
+// endregion Loader Cache
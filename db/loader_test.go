@@ -0,0 +1,197 @@
+package db_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"github.com/xiaojiecode/dubhe/db/ds"
+	"gorm.io/gorm"
+)
+
+type Author struct {
+	db.ModelI64
+	Name string
+}
+
+func (Author) TableName() string { return "authors" }
+func (Author) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true}
+}
+
+func TestLoader(t *testing.T) {
+	repo := db.NewRepo[Author, int64]()
+	var ids []int64
+	for _, name := range []string{"a", "b", "c"} {
+		id, _ := repo.Create(&Author{Name: name})
+		ids = append(ids, id)
+	}
+
+	var queries atomic.Int32
+	_ = testDB.Callback().Query().After("gorm:query").Register("loader_test:count", func(tx *gorm.DB) {
+		if tx.Statement.Table == "authors" {
+			queries.Add(1)
+		}
+	})
+	defer testDB.Callback().Query().Remove("loader_test:count")
+
+	loader := db.NewLoader(repo, 10*time.Millisecond)
+	ctx := db.WithLoaderCache(context.Background())
+	var wg sync.WaitGroup
+	for i := range 9 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := ids[i%3]
+			a, err := loader.Load(ctx, id)
+			if err != nil || a == nil || a.ID != id {
+				t.Errorf("load %d failed: %v, %+v", id, err, a)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := queries.Load(); n != 1 {
+		t.Fatalf("expected 1 batched query, got %d", n)
+	}
+
+	// 同一请求内再次加载直接命中请求级缓存
+	if a, _ := loader.Load(ctx, ids[1]); a == nil || a.Name != "b" || queries.Load() != 1 {
+		t.Fatalf("request cache miss: %+v, %d queries", a, queries.Load())
+	}
+
+	// wait<=0 时由 Tick 显式发出
+	manual := db.NewLoader(repo, 0)
+	done := make(chan []*Author)
+	go func() {
+		res, _ := manual.LoadMany(context.Background(), []int64{ids[2], -1, ids[0]})
+		done <- res
+	}()
+	var res []*Author
+	for res == nil {
+		select {
+		case res = <-done:
+		case <-time.After(5 * time.Millisecond):
+			manual.Tick()
+		}
+	}
+	if len(res) != 3 || res[0].Name != "c" || res[1] != nil || res[2].Name != "a" {
+		t.Fatalf("load many failed: %+v", res)
+	}
+}
+
+func TestLoaderTenantBatches(t *testing.T) {
+	cleanTables(t, "invoices")
+	repo := db.NewRepo[Invoice, int64]()
+	ctxA := ds.WithTenant(context.Background(), "a")
+	ctxB := ds.WithTenant(context.Background(), "b")
+	a := &Invoice{Amount: 1}
+	b := &Invoice{Amount: 2}
+	_, _ = repo.WithCtx(&ctxA).Create(a)
+	_, _ = repo.WithCtx(&ctxB).Create(b)
+
+	// Repo 未设置上下文：不同租户的请求分属不同批次，各自以调用方的上下文查询
+	loader := db.NewLoader(repo, 10*time.Millisecond)
+	var wg sync.WaitGroup
+	res := make([][]*Invoice, 2)
+	for i, ctx := range []context.Context{ctxA, ctxB} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if res[i], err = loader.LoadMany(ctx, []int64{a.ID, b.ID}); err != nil {
+				t.Errorf("load many failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if res[0][0] == nil || res[0][1] != nil || res[1][0] != nil || res[1][1] == nil {
+		t.Fatalf("loads should be scoped to the caller's tenant: %+v", res)
+	}
+}
+
+type loaderPanicKey struct{}
+type loaderRoleKey struct{}
+
+func TestLoaderBatchContext(t *testing.T) {
+	repo := db.NewRepo[Author, int64]()
+	id, _ := repo.Create(&Author{Name: "ctx"})
+
+	var queries atomic.Int32
+	_ = testDB.Callback().Query().After("gorm:query").Register("loader_test:ctx", func(tx *gorm.DB) {
+		if tx.Statement.Table != "authors" {
+			return
+		}
+		queries.Add(1)
+		if tx.Statement.Context.Value(loaderPanicKey{}) != nil {
+			panic("boom")
+		}
+	})
+	defer testDB.Callback().Query().Remove("loader_test:ctx")
+
+	// tick 反复发出批次直到 load 返回
+	tick := func(loader *db.Loader[Author, int64], load func() error) error {
+		done := make(chan error, 1)
+		go func() { done <- load() }()
+		for {
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(5 * time.Millisecond):
+				loader.Tick()
+			}
+		}
+	}
+
+	// 首个调用方取消后，同批次的其它调用方仍可拿到结果
+	loader := db.NewLoader(repo, 0)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := loader.Load(canceled, id); err != context.Canceled {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	var got *Author
+	err := tick(loader, func() (err error) {
+		got, err = loader.Load(context.Background(), id)
+		return err
+	})
+	if err != nil || got == nil || got.Name != "ctx" {
+		t.Fatalf("batch should not fail with the first caller's cancellation: %v, %+v", err, got)
+	}
+
+	// 操作人或 KeyBy 的值不同时分属不同批次
+	queries.Store(0)
+	role := func(ctx context.Context) string { s, _ := ctx.Value(loaderRoleKey{}).(string); return s }
+	loader = db.NewLoader(repo, 10*time.Millisecond).KeyBy(role)
+	var wg sync.WaitGroup
+	for _, ctx := range []context.Context{
+		db.WithActor(context.Background(), "alice"),
+		db.WithActor(context.Background(), "bob"),
+		db.WithActor(context.Background(), "bob"),
+		context.WithValue(db.WithActor(context.Background(), "bob"), loaderRoleKey{}, "admin"),
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if a, err := loader.Load(ctx, id); err != nil || a == nil {
+				t.Errorf("load failed: %v, %+v", err, a)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := queries.Load(); n != 3 {
+		t.Fatalf("expected one batch per actor and role, got %d queries", n)
+	}
+
+	// 查询 panic 作为错误返回，不阻塞调用方
+	loader = db.NewLoader(repo, 0)
+	err = tick(loader, func() error {
+		_, err := loader.Load(context.WithValue(context.Background(), loaderPanicKey{}, "panic"), id)
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected error from panicking batch")
+	}
+}
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	gclause "gorm.io/gorm/clause"
+)
+
+// region Outbox
+
+// OutboxMessage outbox 表结构，与业务写操作在同一事务中写入，由 Relay 投递
+type OutboxMessage struct {
+	ID            int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Topic         string     `gorm:"size:255;index" json:"topic"`
+	Key           string     `gorm:"column:msg_key;size:255" json:"key"` // 消息键，默认为受影响记录的主键
+	Payload       string     `gorm:"type:text" json:"payload"`           // JSON 编码的 Event[T, K]
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	LeaseOwner    string     `gorm:"size:64;index" json:"-"` // 领取该消息的 Relay 批次
+	LeaseUntil    *time.Time `json:"-"`                      // 租约到期后可被重新领取
+	LastError     string     `gorm:"type:text" json:"last_error"`
+	DeliveredAt   *time.Time `gorm:"index" json:"delivered_at"`
+	FailedAt      *time.Time `json:"failed_at"` // 达到 RelayCfg.MaxAttempts 后放弃投递的时间
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (OutboxMessage) TableName() string { return "outbox" }
+
+// Outbox 发件箱，通过 RepoCfg.Outbox 挂到 Repo 上：写操作事件在同一事务中写入 outbox 表，
+// 提交后由 Relay 投递，进程在提交与投递之间退出也不会丢失消息
+type Outbox struct {
+	mu     sync.RWMutex
+	routes map[reflect.Type][]outboxRoute
+}
+
+type outboxRoute struct {
+	topic string
+	ops   []OpKind
+}
+
+// NewOutbox 创建发件箱
+func NewOutbox() *Outbox {
+	return &Outbox{routes: make(map[reflect.Type][]outboxRoute)}
+}
+
+// Record 将模型 T 的写操作事件以 JSON 写入发件箱的 topic，ops 为空时记录全部写操作
+func Record[T IModel[K], K Key](o *Outbox, topic string, ops ...OpKind) {
+	typ := reflect.TypeFor[T]()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.routes[typ] = append(o.routes[typ], outboxRoute{topic: topic, ops: ops})
+}
+
+// topics 记录 typ 模型 op 操作的 topic
+func (o *Outbox) topics(typ reflect.Type, op OpKind) []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var res []string
+	for _, route := range o.routes[typ] {
+		if len(route.ops) == 0 || slices.Contains(route.ops, op) {
+			res = append(res, route.topic)
+		}
+	}
+	return res
+}
+
+// write 在 tx 中为每个 topic 写入一条消息
+func (o *Outbox) write(tx *gorm.DB, topics []string, key string, event any) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	msgs := make([]OutboxMessage, len(topics))
+	for i, topic := range topics {
+		msgs[i] = OutboxMessage{Topic: topic, Key: key, Payload: string(payload), NextAttemptAt: now, CreatedAt: now}
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&msgs).Error
+}
+
+// outboxKey 受影响记录主键拼接的消息键
+func outboxKey[K Key](ids []K) string {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprint(id)
+	}
+	return strings.Join(keys, ",")
+}
+
+// endregion Outbox
+
+// region Relay
+
+// Publisher 消息发布者，如消息队列客户端；返回错误时消息按退避策略重试
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+}
+
+// PublisherFunc 函数形式的 Publisher
+type PublisherFunc func(ctx context.Context, msg OutboxMessage) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg OutboxMessage) error {
+	return f(ctx, msg)
+}
+
+// MemoryPublisher 进程内发布者，按顺序保存已发布的消息，用于测试
+type MemoryPublisher struct {
+	mu   sync.Mutex
+	msgs []OutboxMessage
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, msg OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+// Messages 已发布消息的副本
+func (p *MemoryPublisher) Messages() []OutboxMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.msgs)
+}
+
+// RelayCfg Relay 配置，零值字段使用默认值
+type RelayCfg struct {
+	BatchSize   int                                  // 每次领取的消息数，默认 100
+	Interval    time.Duration                        // 无待投递消息时的轮询间隔，默认 1s
+	Lease       time.Duration                        // 领取后的租约时长，超时未完成的消息可被重新领取，默认 30s
+	MaxAttempts int                                  // 最大投递次数，达到后标记失败不再重试，0 为不限
+	Backoff     func(attempts int) time.Duration     // 第 attempts 次失败后的重试间隔，默认从 1s 起指数增长，最长 10min
+	OnError     func(ctx context.Context, err error) // 接收投递与轮询错误，可为 nil
+}
+
+// Relay 发件箱投递进程：轮询到期消息，通过 Publisher 投递并标记完成。
+// mysql 使用 FOR UPDATE SKIP LOCKED 领取，其它驱动以单条 UPDATE 写入租约列领取；
+// 投递语义为至少一次，消费方需按消息 ID 幂等
+type Relay struct {
+	db  *gorm.DB
+	pub Publisher
+	cfg RelayCfg
+}
+
+// NewRelay 创建投递进程，db 为 outbox 表所在的连接
+func NewRelay(db *gorm.DB, pub Publisher, cfg RelayCfg) *Relay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	if cfg.Backoff == nil {
+		cfg.Backoff = defaultBackoff
+	}
+	return &Relay{db: db, pub: pub, cfg: cfg}
+}
+
+func defaultBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return 10 * time.Minute
+	}
+	return min(time.Second<<(attempts-1), 10*time.Minute)
+}
+
+// Run 持续轮询投递直到 ctx 取消；有积压时连续领取，否则等待 Interval
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.Poll(ctx)
+		if err != nil {
+			r.report(ctx, err)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.cfg.Interval):
+		}
+	}
+}
+
+// Poll 领取一批到期消息并逐条投递，返回领取的条数
+func (r *Relay) Poll(ctx context.Context) (int, error) {
+	token, err := leaseToken()
+	if err != nil {
+		return 0, err
+	}
+	db := r.db.WithContext(ctx).Session(&gorm.Session{NewDB: true})
+	msgs, err := r.claim(db, token)
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			// 未投递的消息待租约到期后重新领取
+			return len(msgs), err
+		}
+		if err := r.deliver(ctx, db, token, msg); err != nil {
+			return len(msgs), err
+		}
+	}
+	return len(msgs), nil
+}
+
+// claim 领取到期且未被租用的消息，写入本批次的租约
+func (r *Relay) claim(db *gorm.DB, token string) ([]OutboxMessage, error) {
+	now := time.Now().UTC()
+	lease := map[string]any{"lease_owner": token, "lease_until": now.Add(r.cfg.Lease)}
+	pending := func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&OutboxMessage{}).
+			Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+			Where("lease_until IS NULL OR lease_until < ?", now).
+			Order("id").Limit(r.cfg.BatchSize)
+	}
+	var err error
+	if db.Dialector.Name() == "mysql" {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var ids []int64
+			locking := gclause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}
+			if err := pending(tx).Clauses(locking).Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+				return err
+			}
+			return tx.Model(&OutboxMessage{}).Where("id IN ?", ids).Updates(lease).Error
+		})
+	} else {
+		err = db.Model(&OutboxMessage{}).Where("id IN (?)", pending(db).Select("id")).Updates(lease).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []OutboxMessage
+	err = db.Where("lease_owner = ?", token).Order("id").Find(&msgs).Error
+	return msgs, err
+}
+
+// deliver 投递一条消息，成功标记完成，失败累加次数并按退避时间重新排期
+func (r *Relay) deliver(ctx context.Context, db *gorm.DB, token string, msg OutboxMessage) error {
+	err := r.publish(ctx, msg)
+	now := time.Now().UTC()
+	updates := map[string]any{"lease_owner": "", "lease_until": nil}
+	if err == nil {
+		updates["delivered_at"] = now
+	} else {
+		r.report(ctx, fmt.Errorf("outbox message %d: %w", msg.ID, err))
+		attempts := msg.Attempts + 1
+		updates["attempts"] = attempts
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(r.cfg.Backoff(attempts))
+		if r.cfg.MaxAttempts > 0 && attempts >= r.cfg.MaxAttempts {
+			updates["failed_at"] = now
+		}
+	}
+	// 租约已被其它批次接管时不覆盖
+	return db.Model(&OutboxMessage{}).Where("id = ? AND lease_owner = ?", msg.ID, token).Updates(updates).Error
+}
+
+func (r *Relay) publish(ctx context.Context, msg OutboxMessage) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("publisher panic: %v", p)
+		}
+	}()
+	return r.pub.Publish(ctx, msg)
+}
+
+func (r *Relay) report(ctx context.Context, err error) {
+	if r.cfg.OnError != nil {
+		r.cfg.OnError(ctx, err)
+	}
+}
+
+// leaseToken 本次领取的随机租约标识
+func leaseToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// endregion Relay
@@ -0,0 +1,104 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+var paymentOutbox = func() *db.Outbox {
+	o := db.NewOutbox()
+	db.Record[Payment, int64](o, "payment.created", db.OpCreate)
+	db.Record[Payment, int64](o, "payment.changed", db.OpUpdate, db.OpDel)
+	return o
+}()
+
+type Payment struct {
+	db.ModelI64
+	Amount int64
+}
+
+func (Payment) TableName() string { return "payments" }
+func (Payment) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Outbox: paymentOutbox}
+}
+
+func TestOutbox(t *testing.T) {
+	cleanTables(t, "payments", "outbox")
+	repo := db.NewRepo[Payment, int64]()
+	ctx := context.Background()
+
+	// 回滚的写操作不留下消息
+	tx := repo.Begin()
+	if _, err := tx.Create(&Payment{Amount: 1}); err != nil {
+		t.Fatalf("create in tx failed: %v", err)
+	}
+	_ = tx.Rollback()
+
+	id, err := repo.Create(&Payment{Amount: 100})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := repo.Eq("id", id).Set("amount", 200).Update(); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	// 投递中的消息已被租用，其它 Relay 领取不到
+	pub := &db.MemoryPublisher{}
+	other := db.NewRelay(testDB, pub, db.RelayCfg{})
+	var reclaimed int
+	relay := db.NewRelay(testDB, db.PublisherFunc(func(ctx context.Context, msg db.OutboxMessage) error {
+		n, err := other.Poll(ctx)
+		reclaimed += n
+		if err != nil {
+			return err
+		}
+		return pub.Publish(ctx, msg)
+	}), db.RelayCfg{})
+	if n, err := relay.Poll(ctx); err != nil || n != 2 {
+		t.Fatalf("poll should claim 2 messages: %d %v", n, err)
+	}
+	if reclaimed != 0 {
+		t.Fatalf("leased messages should not be claimed again: %d", reclaimed)
+	}
+	msgs := pub.Messages()
+	if len(msgs) != 2 || msgs[0].Topic != "payment.created" || msgs[1].Topic != "payment.changed" {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+	var e db.Event[Payment, int64]
+	if err := json.Unmarshal([]byte(msgs[0].Payload), &e); err != nil || e.Op != db.OpCreate || e.IDs[0] != id || e.Entities[0].Amount != 100 {
+		t.Fatalf("unexpected payload: %+v %v", e, err)
+	}
+	if n, _ := relay.Poll(ctx); n != 0 {
+		t.Fatal("delivered messages should not be polled again")
+	}
+
+	// 投递失败按退避重试，达到最大次数后放弃
+	if _, err := repo.Eq("id", id).Del(); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+	var errs int
+	failing := db.NewRelay(testDB, db.PublisherFunc(func(context.Context, db.OutboxMessage) error {
+		return errors.New("broker down")
+	}), db.RelayCfg{
+		MaxAttempts: 2,
+		Backoff:     func(int) time.Duration { return 0 },
+		OnError:     func(context.Context, error) { errs++ },
+	})
+	for range 3 {
+		if _, err := failing.Poll(ctx); err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+	}
+	var failed db.OutboxMessage
+	if err := testDB.Where("topic = ? AND failed_at IS NOT NULL", "payment.changed").Last(&failed).Error; err != nil {
+		t.Fatalf("message should be marked failed: %v", err)
+	}
+	if errs != 2 || failed.Attempts != 2 || failed.LastError != "broker down" || failed.DeliveredAt != nil {
+		t.Fatalf("unexpected failed message: %d %+v", errs, failed)
+	}
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+	"gorm.io/gorm"
+)
+
+// preload 关联预加载配置
+type preload struct {
+	path  string                // 关联路径，支持嵌套如 "Orders.Items"
+	conds []func(*clause.Match) // 关联查询的条件与排序
+}
+
+// match 合并预加载条件
+func (p preload) match() *clause.Match {
+	m := clause.NewMatch()
+	for _, c := range p.conds {
+		c(m)
+	}
+	return m
+}
+
+// Preload 预加载关联，conds 通过 clause.Match 为关联查询追加条件与排序，返回新的 Repo 实例
+func (r *Repo[T, K]) Preload(path string, conds ...func(*clause.Match)) IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.preloads = append(newRepo.preloads, preload{path: path, conds: conds})
+	return newRepo
+}
+
+// Join 通过 LEFT JOIN 加载 belongs-to/has-one 关联（支持嵌套如 "Manager.Company"），
+// 关联表以关联名为别名，Match 中可使用 "Company.name" 形式的字段，返回新的 Repo 实例
+func (r *Repo[T, K]) Join(assoc string) IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.joins = append(newRepo.joins, assoc)
+	return newRepo
+}
+
+// applyRelations 在查询上追加预加载与关联 JOIN
+func (r *Repo[T, K]) applyRelations(db *gorm.DB) *gorm.DB {
+	for _, j := range r.joins {
+		db = db.Joins(j)
+	}
+	for _, p := range r.preloads {
+		if len(p.conds) == 0 {
+			db = db.Preload(p.path)
+			continue
+		}
+		m := p.match()
+		db = db.Preload(p.path, func(tx *gorm.DB) *gorm.DB {
+			if sql, args := m.WhereSql(); sql != "" {
+				tx = tx.Where(sql, args...)
+			}
+			if orders := m.OrderSql(); orders != "" {
+				tx = tx.Order(orders)
+			}
+			return tx
+		})
+	}
+	return db
+}
+
+// qualify 存在 JOIN 时为未限定表名的字段加上主表名，避免列名歧义
+func (r *Repo[T, K]) qualify(m *clause.Match) *clause.Match {
+	if len(r.joins) == 0 {
+		return m
+	}
+	table := r.table
+	if r.shardTable != "" {
+		table = r.shardTable
+	}
+	q := m.Clone()
+	for _, cs := range [][]clause.Clause{q.Clauses, q.Orders} {
+		for i := range cs {
+			// 已带表名或为复合主键的行值 "(a, b)" 时保持原样
+			if cs[i].Field != "" && !strings.ContainsAny(cs[i].Field, ".(") {
+				cs[i].Field = table + "." + cs[i].Field
+			}
+		}
+	}
+	return q
+}
+
+// qualifyFields 存在 JOIN 时为 Select/Omit 字段加上主表名
+func (r *Repo[T, K]) qualifyFields(fields []string) []string {
+	if len(r.joins) == 0 || len(fields) == 0 {
+		return fields
+	}
+	table := r.table
+	if r.shardTable != "" {
+		table = r.shardTable
+	}
+	res := make([]string, len(fields))
+	for i, f := range fields {
+		if strings.Contains(f, ".") {
+			res[i] = f
+		} else {
+			res[i] = table + "." + f
+		}
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"github.com/xiaojiecode/dubhe/db/clause"
+)
+
+type Company struct {
+	db.ModelI64
+	Name string
+}
+
+type Customer struct {
+	db.ModelI64
+	Name      string
+	CompanyID int64
+	Company   Company
+	Orders    []Order
+}
+
+type Order struct {
+	db.ModelI64
+	CustomerID int64
+	Status     string
+	Items      []OrderItem
+}
+
+type OrderItem struct {
+	db.ModelI64
+	OrderID int64
+	Sku     string
+}
+
+func (Customer) TableName() string { return "customers" }
+func (Customer) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true}
+}
+
+func TestRelations(t *testing.T) {
+	cleanTables(t, "customers", "companies", "orders", "order_items")
+	if err := testDB.AutoMigrate(&Company{}, &Order{}, &OrderItem{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := db.NewRepo[Customer, int64]()
+	_, err := repo.Create(&Customer{Name: "c1", Company: Company{Name: "acme"}, Orders: []Order{
+		{Status: "paid", Items: []OrderItem{{Sku: "a"}, {Sku: "b"}}},
+		{Status: "open", Items: []OrderItem{{Sku: "c"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = repo.Create(&Customer{Name: "c2", Company: Company{Name: "other"}})
+
+	c, err := repo.Eq("name", "c1").
+		Preload("Orders", func(m *clause.Match) { m.Eq("status", "paid") }).
+		Preload("Orders.Items", func(m *clause.Match) { m.Desc("sku") }).
+		Get()
+	if err != nil || c == nil || len(c.Orders) != 1 || len(c.Orders[0].Items) != 2 || c.Orders[0].Items[0].Sku != "b" {
+		t.Fatalf("preload failed: %v, %+v", err, c)
+	}
+
+	list, err := repo.Join("Company").Eq("Company.name", "acme").Desc("id").List()
+	if err != nil || len(list) != 1 || list[0].Company.Name != "acme" {
+		t.Fatalf("join failed: %v, %+v", err, list)
+	}
+	page, err := repo.Join("Company").Preload("Orders").Asc("Company.name").PageMT(10, 1)
+	if err != nil || page.Total != 2 || page.Result[0].Company.Name != "acme" || len(page.Result[0].Orders) != 2 {
+		t.Fatalf("join page failed: %v, %+v", err, page)
+	}
+}
@@ -5,26 +5,38 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xiaojiecode/dubhe/db/clause"
+	"github.com/xiaojiecode/dubhe/db/ds"
 	"gorm.io/gorm"
+	gclause "gorm.io/gorm/clause"
 )
 
 // region Base Model Define
 
+// ID 单列主键类型：整数或字符串，基础模型 ModelT、ModelGen 的主键
 type ID interface {
 	int | int8 | int16 | int32 | int64 | uint | uint8 | uint16 | uint32 | uint64 | string
 }
 
+// Key Repo 的主键类型：ID，或由各主键字段组成的可比较结构体（复合主键，字段名需与模型主键字段一致）、
+// time.Time 等其它可比较的单列主键
+type Key interface {
+	comparable
+}
+
 // IModel ModelT Interface
-type IModel[T ID] interface {
+type IModel[T Key] interface {
 	GetID() T
 	IsNil() bool
 }
 
 // ModelT Define
 
+// ModelT 数据库自增主键的基础模型，T 应为整数；字符串或应用生成的主键使用 ModelGen、ModelUUID、ModelULID
 type ModelT[T ID] struct {
 	ID        T              `gorm:"primaryKey;autoIncrement" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -45,6 +57,24 @@ func (m ModelT[T]) IsNil() bool {
 	return false
 }
 
+// ModelGen 主键由应用赋值（IDGenerator 或手动）的基础模型，不带 autoIncrement，
+// 适用于字符串主键与雪花等生成的整数主键；ModelT 的主键为数据库自增，仅适用于整数
+type ModelGen[T ID] struct {
+	ID        T              `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (m ModelGen[T]) GetID() T {
+	return m.ID
+}
+
+func (m ModelGen[T]) IsNil() bool {
+	var t T
+	return m.ID == t
+}
+
 type ModelI64 struct {
 	ID        int64          `gorm:"primaryKey;autoIncrement" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -116,7 +146,7 @@ func ToAnySlice[T any](src []T) []any {
 // region Base Repository
 
 // IRepo Repo Interface T: Model Entity K: Model Primary Key Type
-type IRepo[T IModel[K], K ID] interface {
+type IRepo[T IModel[K], K Key] interface {
 	DB() *gorm.DB
 	// Tx 使用现有事务或开启新事务
 	Tx() IRepo[T, K]
@@ -126,21 +156,51 @@ type IRepo[T IModel[K], K ID] interface {
 	Commit() error
 	// Rollback 回滚事务
 	Rollback() error
+	// OnCommit 注册事务提交成功后执行的回调
+	OnCommit(func()) error
+	// OnRollback 注册事务回滚后执行的回调
+	OnRollback(func()) error
 	// Clone 克隆当前Repo实例
 	Clone() IRepo[T, K]
 	// WithCtx 设置上下文
 	WithCtx(*context.Context) IRepo[T, K]
 	// WithDB 使用自定义DB连接
 	WithDB(*gorm.DB) IRepo[T, K]
+	// Primary 强制读操作走主库（读己之写）
+	Primary() IRepo[T, K]
+	// AcrossTenants 跨租户操作，跳过行级租户限定
+	AcrossTenants() IRepo[T, K]
+	// WithoutScope 排除指定名称的全局作用域
+	WithoutScope(...string) IRepo[T, K]
+	// ScopeMatch 当前生效的全局作用域条件
+	ScopeMatch() *clause.Match
+	// AllShards 允许无法按分片键定位的 Update/Del 扇出到全部分片表
+	AllShards() IRepo[T, K]
+	// Cached 缓存 List/Count/Page 的查询结果，该表任意写操作后失效
+	Cached(time.Duration) IRepo[T, K]
 	// Raw 执行原生SQL
 	Raw(string, ...any) IRawQueryRepo[T, K]
 	// Exec 执行原生SQL命令
 	Exec(string, ...any) (int64, error)
+	// Watch 订阅本表此后的变更（需配置 RepoCfg.ChangeLog）
+	Watch(context.Context) <-chan Change[T, K]
+	// WatchFrom 从指定变更位置之后续读本表的变更
+	WatchFrom(context.Context, int64) <-chan Change[T, K]
 
 	// Get 匹配获取新纪录, 不存在返回nil
 	Get() (*T, error)
 	// GetByID 根据ID获取记录, 不存在返回nil
 	GetByID(K) (*T, error)
+	// GetByIDs 根据ID批量获取记录
+	GetByIDs([]K) (map[K]*T, error)
+	// ListByIDs 根据ID批量获取记录，保持传入顺序
+	ListByIDs([]K) ([]T, error)
+	// ReportMissing GetByIDs/ListByIDs 未找到部分 ID 时返回 *MissingIDsError
+	ReportMissing() IRepo[T, K]
+	// Preload 预加载关联，支持嵌套路径与关联查询条件
+	Preload(string, ...func(*clause.Match)) IRepo[T, K]
+	// Join 通过 JOIN 加载关联，Match 可使用 "关联名.字段" 作为条件
+	Join(string) IRepo[T, K]
 	// GetOrInit 获取单挑记录, 不存在返回空记录
 	GetOrInit() (*T, error)
 	// List 查询列表数据
@@ -209,7 +269,7 @@ type IRepo[T IModel[K], K ID] interface {
 	Limit(int64) IRepo[T, K]
 }
 
-type IRawQueryRepo[T IModel[K], K ID] interface {
+type IRawQueryRepo[T IModel[K], K Key] interface {
 	// Get 查询单条数据，查询不到返回nil
 	Get() (*T, error)
 	// GetOrInit 查询或初始化对象
@@ -224,51 +284,136 @@ type IRawQueryRepo[T IModel[K], K ID] interface {
 
 // region IRepo Bases Impl
 
-type RepoTemplate[T IModel[K], K ID] struct {
-	ctx   *context.Context
-	table string
-	model *T
-	key   string
-	cfg   *RepoCfg
+type RepoTemplate[T IModel[K], K Key] struct {
+	table        string
+	model        *T
+	key          string
+	cfg          *RepoCfg
+	autoMigrate  bool           // 通过 Resolver 解析到新连接时是否自动迁移
+	migrated     sync.Map       // 已完成自动迁移的连接，key 为 *gorm.DB 或 shardMigrateKey，数据源关闭时移除
+	tenantColumn string         // 行级多租户的租户列，为空表示不开启
+	scopes       []Scope        // 全局作用域
+	idGen        IDGenerator[K] // 主键生成器，为空表示由数据库生成
+	flight       flightGroup    // 合并缓存未命中时的并发加载
+	cacheGen     atomic.Uint64  // 写操作计数，用于放弃过期的实体回填与使查询结果缓存过期
+}
+
+// rawExpr 原生 SQL 片段及其参数
+type rawExpr struct {
+	sql  string
+	args []any
 }
 
-type Repo[T IModel[K], K ID] struct {
+type Repo[T IModel[K], K Key] struct {
 	*RepoTemplate[T, K]
 	db      *gorm.DB
-	selects []string
-	omits   []string
-	match   clause.Match
-	page    *Page
-	limit   int64
-	isRaw   bool
+	ctx     *context.Context
+	bound   bool     // 已绑定自定义连接或事务，不再经过 Resolver 解析
+	source  string   // 所属数据源名称，用于读写分离；自定义DB时为空
+	primary bool     // 读操作强制走主库
+	hooks   *txHooks // 由 Tx/Begin 开启的事务的提交、回滚回调
+	err     error    // Tx/Begin 未能解析连接的错误，由之后的操作与 Commit/Rollback 返回
+	// 跨租户操作，跳过行级租户限定
+	acrossTenants bool
+	skipScopes    []string      // 本次操作排除的全局作用域
+	shardTable    string        // 已定位的分片表，为空表示按分片配置路由
+	allShards     bool          // 允许写操作扇出到全部分片
+	cacheTTL      time.Duration // 查询结果缓存时长，<=0 表示不缓存
+	reportMissing bool          // 批量按ID查询时报告缺失的 ID
+	preloads      []preload     // 预加载的关联
+	joins         []string      // JOIN 加载的关联
+	intercepted   bool          // 已在拦截器链中执行，嵌套调用不再拦截
+	writeTx       bool          // 已在审计/发件箱的写事务流程中执行
+	// 跨租户硬删除前读取的各记录租户，供变更记录使用，仅在本次 del 内有效
+	deletedTenants map[K]string
+	selects        []string
+	omits          []string
+	wheres         []rawExpr
+	raw            *rawExpr
+	match          clause.Match
+	page           *Page
+	limit          int64
+	isRaw          bool
 }
 
 func (r *Repo[T, K]) DB() *gorm.DB {
-	return r.db
+	db, err := r.conn()
+	if err != nil {
+		if r.err != nil && r.db != nil {
+			// 事务未能开启，返回携带错误的会话，避免在事务外执行
+			db = r.db.Session(&gorm.Session{NewDB: true})
+			_ = db.AddError(r.err)
+			return db
+		}
+		return r.db
+	}
+	return db
 }
 
-// Tx 返回新的事务 Repo 实例，独立于当前 Repo
+// Tx 返回新的事务 Repo 实例，独立于当前 Repo；无法解析连接时（如上下文缺少租户）
+// 错误由返回实例之后的操作与 Commit/Rollback 返回
 func (r *Repo[T, K]) Tx() IRepo[T, K] {
 	newRepo := r.cloneInternal()
-	newRepo.db = newRepo.db.Begin().Session(&gorm.Session{NewDB: true})
+	db, err := newRepo.conn()
+	if err != nil {
+		return newRepo.failTx(err)
+	}
+	newRepo.db = db.Begin().Session(&gorm.Session{NewDB: true})
+	newRepo.bound = true
+	newRepo.hooks = newTxHooks(db)
 	return newRepo
 }
 
 func (r *Repo[T, K]) Begin() IRepo[T, K] {
-	newRepo := r.cloneInternal()
-	newRepo.db = newRepo.db.Begin()
+	newRepo, err := r.beginTx()
+	if err != nil {
+		return r.cloneInternal().failTx(err)
+	}
 	return newRepo
 }
 
+// failTx 未能开启事务：记录错误，不再经过 Resolver 解析，之后的操作均返回该错误
+func (r *Repo[T, K]) failTx(err error) *Repo[T, K] {
+	r.err = err
+	r.bound = true
+	return r
+}
+
+// beginTx 开启新事务，返回事务 Repo
+func (r *Repo[T, K]) beginTx() (*Repo[T, K], error) {
+	newRepo := r.cloneInternal()
+	db, err := newRepo.conn()
+	if err != nil {
+		return nil, err
+	}
+	newRepo.db = db.Begin()
+	newRepo.bound = true
+	newRepo.hooks = newTxHooks(db)
+	return newRepo, nil
+}
+
 func (r *Repo[T, K]) Commit() error {
+	if r.err != nil {
+		return r.err
+	}
 	newRepo := r.cloneInternal()
 	db := newRepo.db.Commit()
-	return db.Error
+	if db.Error != nil {
+		// 提交失败时事务已不可用，按回滚执行回调
+		return errors.Join(db.Error, newRepo.runTxHooks(false))
+	}
+	return newRepo.runTxHooks(true)
 }
 
 func (r *Repo[T, K]) Rollback() error {
+	if r.err != nil {
+		return r.err
+	}
 	newRepo := r.cloneInternal()
-	return newRepo.db.Rollback().Error
+	if err := newRepo.db.Rollback().Error; err != nil {
+		return err
+	}
+	return newRepo.runTxHooks(false)
 }
 
 func (r *Repo[T, K]) cloneInternal() *Repo[T, K] {
@@ -279,14 +424,32 @@ func (r *Repo[T, K]) cloneInternal() *Repo[T, K] {
 	}
 
 	return &Repo[T, K]{
-		RepoTemplate: r.RepoTemplate,
-		db:           r.db,
-		selects:      slices.Clone(r.selects),
-		match:        *r.match.Clone(),
-		page:         newPage,
-		limit:        r.limit,
-		omits:        slices.Clone(r.omits),
-		isRaw:        r.isRaw,
+		RepoTemplate:  r.RepoTemplate,
+		db:            r.db,
+		ctx:           r.ctx,
+		bound:         r.bound,
+		source:        r.source,
+		primary:       r.primary,
+		hooks:         r.hooks,
+		err:           r.err,
+		acrossTenants: r.acrossTenants,
+		skipScopes:    slices.Clone(r.skipScopes),
+		shardTable:    r.shardTable,
+		allShards:     r.allShards,
+		cacheTTL:      r.cacheTTL,
+		reportMissing: r.reportMissing,
+		preloads:      slices.Clone(r.preloads),
+		joins:         slices.Clone(r.joins),
+		intercepted:   r.intercepted,
+		writeTx:       r.writeTx,
+		selects:       slices.Clone(r.selects),
+		wheres:        slices.Clone(r.wheres),
+		raw:           r.raw,
+		match:         *r.match.Clone(),
+		page:          newPage,
+		limit:         r.limit,
+		omits:         slices.Clone(r.omits),
+		isRaw:         r.isRaw,
 	}
 }
 
@@ -299,6 +462,7 @@ func (r *Repo[T, K]) Clone() IRepo[T, K] {
 func (r *Repo[T, K]) WithCtx(ctx *context.Context) IRepo[T, K] {
 	newRepo := r.cloneInternal()
 	newRepo.ctx = ctx
+	newRepo.joinTx()
 	return newRepo
 }
 
@@ -308,9 +472,162 @@ func (r *Repo[T, K]) WithDB(db *gorm.DB) IRepo[T, K] {
 		panic("db can not be nil")
 	}
 	r.db = db
+	r.bound = true
+	r.err = nil
+	r.source = ""
 	return r
 }
 
+// Primary 强制读操作走主库，返回新的 Repo 实例
+func (r *Repo[T, K]) Primary() IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.primary = true
+	return newRepo
+}
+
+// context 当前 Repo 的上下文，未设置时为 context.Background()
+func (r *Repo[T, K]) context() context.Context {
+	if r.ctx == nil || *r.ctx == nil {
+		return context.Background()
+	}
+	return *r.ctx
+}
+
+// conn 本次操作使用的基础连接：配置了 Resolver 且未绑定自定义连接或事务时按上下文解析，并携带上下文
+func (r *Repo[T, K]) conn() (*gorm.DB, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	db := r.db
+	if r.cfg.Resolver != nil && !r.bound {
+		resolved, err := r.cfg.Resolver.Resolve(r.context())
+		if err != nil {
+			return nil, err
+		}
+		if err := r.ensureMigrated(resolved); err != nil {
+			return nil, err
+		}
+		db = resolved
+	}
+	if db == nil {
+		return nil, fmt.Errorf("%s: no db available", r.key)
+	}
+	if r.ctx != nil {
+		db = db.WithContext(r.context())
+	}
+	if r.encrypted() {
+		if err := registerEncryption(db); err != nil {
+			return nil, err
+		}
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		db = db.WithContext(withKeyProvider(ctx, r.cfg.Encryption))
+	}
+	return db, nil
+}
+
+// ensureMigrated 对 Resolver 解析出的连接只执行一次自动迁移
+func (r *Repo[T, K]) ensureMigrated(db *gorm.DB) error {
+	if !r.autoMigrate {
+		return nil
+	}
+	if _, loaded := r.migrated.LoadOrStore(db, struct{}{}); loaded {
+		return nil
+	}
+	if err := r.migrate(db); err != nil {
+		r.migrated.Delete(db)
+		return err
+	}
+	return nil
+}
+
+// forgetMigrated 移除已关闭连接的迁移记录，避免淘汰的租户连接池一直被引用
+func (t *RepoTemplate[T, K]) forgetMigrated(db *gorm.DB) {
+	t.migrated.Range(func(key, _ any) bool {
+		switch k := key.(type) {
+		case *gorm.DB:
+			if k == db {
+				t.migrated.Delete(key)
+			}
+		case shardMigrateKey:
+			if k.config == db.Config {
+				t.migrated.Delete(key)
+			}
+		}
+		return true
+	})
+}
+
+// migrate 自动迁移表结构，分表时迁移全部分片表，并迁移审计输出需要的表
+func (r *Repo[T, K]) migrate(db *gorm.DB) error {
+	if m, ok := r.cfg.Audit.(sinkMigrator); ok {
+		if err := m.Migrate(db); err != nil {
+			return err
+		}
+	}
+	if r.cfg.Outbox != nil {
+		if err := db.AutoMigrate(&OutboxMessage{}); err != nil {
+			return err
+		}
+	}
+	var err error
+	if r.cfg.Sharding != nil {
+		err = r.migrateShards(db)
+	} else {
+		err = db.AutoMigrate(r.model)
+	}
+	if err != nil || r.cfg.ChangeLog == CaptureOff {
+		return err
+	}
+	return r.migrateChangeLog(db)
+}
+
+// writeDB 写操作使用的连接，附带分片表、Where 设置的自定义条件与租户条件
+func (r *Repo[T, K]) writeDB() (*gorm.DB, error) {
+	tenant, scoped, err := r.tenantScope()
+	if err != nil {
+		return nil, err
+	}
+	db, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+	if r.shardTable != "" {
+		db = db.Table(r.shardTable)
+	}
+	if scoped {
+		db = db.Where(gclause.Eq{Column: gclause.Column{Table: gclause.CurrentTable, Name: r.tenantColumn}, Value: tenant})
+	}
+	for _, w := range r.wheres {
+		db = db.Where(w.sql, w.args...)
+	}
+	return db, nil
+}
+
+// readDB 读操作使用的连接：数据源配置了从库，且未处于事务、未强制主库时，切换到从库连接池
+func (r *Repo[T, K]) readDB() (*gorm.DB, error) {
+	db, err := r.writeDB()
+	if err != nil {
+		return nil, err
+	}
+	if r.primary || r.source == "" || r.bound {
+		return db, nil
+	}
+	if inTx(db) {
+		return db, nil
+	}
+	replica, ok := ds.Replica(r.source)
+	if !ok {
+		return db, nil
+	}
+	// 复制一份 Statement 再替换连接池，保留已构建的条件且不影响当前实例
+	tx := db.Session(&gorm.Session{Initialized: true})
+	tx.Statement.ConnPool = replica.ConnPool
+	return tx.Session(&gorm.Session{}), nil
+}
+
 // endregion IRepo Bases Impl
 
 // region IRepo Clauses Impl
@@ -333,7 +650,7 @@ func (r *Repo[T, K]) SetMap(m map[string]any) IRepo[T, K] {
 
 func (r *Repo[T, K]) Where(s string, a ...any) IRepo[T, K] {
 	newR := r.cloneInternal()
-	newR.db = newR.db.Where(s, a...)
+	newR.wheres = append(newR.wheres, rawExpr{sql: s, args: a})
 	newR.isRaw = true
 	return newR
 }
@@ -435,51 +752,144 @@ func (r *Repo[T, K]) Limit(i int64) IRepo[T, K] {
 // Exec 执行原生 SQL 写操作（Insert/Update/Delete）
 func (r *Repo[T, K]) Exec(sql string, args ...any) (int64, error) {
 	newRepo := r.cloneInternal()
-	tx := newRepo.db.Exec(sql, args...)
+	if err := newRepo.checkRawTenant(); err != nil {
+		return 0, err
+	}
+	db, err := newRepo.conn()
+	if err != nil {
+		return 0, err
+	}
+	tx := db.Exec(sql, args...)
 	if tx.Error != nil {
 		return 0, tx.Error
 	}
+	newRepo.invalidate()
 	return tx.RowsAffected, nil
 }
 
 // Create 插入单条数据
 func (r *Repo[T, K]) Create(t *T) (K, error) {
+	var k K
+	err := r.intercept(OpCreate, []*T{t}, &k, func(c *Repo[T, K]) (err error) {
+		k, err = c.create(t)
+		return err
+	})
+	return k, err
+}
+
+func (r *Repo[T, K]) create(t *T) (K, error) {
 	var k K
 	if t == nil {
 		return k, fmt.Errorf("t is nil")
 	}
+	if err := r.generateIDs(t); err != nil {
+		return k, err
+	}
+	if r.sharded() {
+		return r.shardCreate(t)
+	}
+	// 新增不记录审计，只有发件箱与变更记录需要事务
+	if r.recordsWrites() && !r.writeTx {
+		_, err := r.inWriteTx(func(c *Repo[T, K]) (int64, error) {
+			var err error
+			k, err = c.create(t)
+			return 0, err
+		})
+		return k, err
+	}
 	newRepo := r.cloneInternal()
+	db, err := newRepo.writeDB()
+	if err != nil {
+		return k, err
+	}
+	if err := newRepo.stampTenantIfScoped(db, t); err != nil {
+		return k, err
+	}
+	if err := newRepo.stampCreated(db, t); err != nil {
+		return k, err
+	}
 	sql, args := newRepo.match.WhereSql()
-	db := newRepo.db.Model(t).Omit(newRepo.omits...)
+	db = db.Model(t).Omit(newRepo.omits...)
 	if sql != "" {
 		db = db.Where(sql, args...)
 	}
-	err := db.Create(t).Error
+	err = db.Create(t).Error
 	if err != nil {
 		return k, err
 	}
-	return (*t).GetID(), err
+	newRepo.invalidate()
+	if err := newRepo.emit(OpCreate, []K{(*t).GetID()}, []*T{t}, nil); err != nil {
+		return k, err
+	}
+	return (*t).GetID(), nil
 }
 
 // CreateBatch 批量插入
 func (r *Repo[T, K]) CreateBatch(ts []*T) (int64, error) {
+	var n int64
+	err := r.intercept(OpCreateBatch, ts, &n, func(c *Repo[T, K]) (err error) {
+		n, err = c.createBatch(ts)
+		return err
+	})
+	return n, err
+}
+
+func (r *Repo[T, K]) createBatch(ts []*T) (int64, error) {
+	if err := r.generateIDs(ts...); err != nil {
+		return 0, err
+	}
+	if r.sharded() {
+		return r.shardCreateBatch(ts)
+	}
+	if r.recordsWrites() && !r.writeTx {
+		return r.inWriteTx(func(c *Repo[T, K]) (int64, error) { return c.createBatch(ts) })
+	}
 	newRepo := r.cloneInternal()
-	db := newRepo.db.Model(new(T)).Omit(newRepo.omits...)
+	db, err := newRepo.writeDB()
+	if err != nil {
+		return 0, err
+	}
+	if err := newRepo.stampTenantIfScoped(db, ts...); err != nil {
+		return 0, err
+	}
+	if err := newRepo.stampCreated(db, ts...); err != nil {
+		return 0, err
+	}
+	db = db.Model(new(T)).Omit(newRepo.omits...)
 	sql, args := newRepo.match.WhereSql()
 	if sql != "" {
 		db = db.Where(sql, args...)
 	}
 
-	err := db.CreateInBatches(ts, 1000).Error
+	err = db.CreateInBatches(ts, 1000).Error
 	if err != nil {
 		return 0, err
 	}
+	newRepo.invalidate()
+	ids := make([]K, 0, len(ts))
+	for _, t := range ts {
+		if t != nil {
+			ids = append(ids, (*t).GetID())
+		}
+	}
+	if err := newRepo.emit(OpCreateBatch, ids, ts, nil); err != nil {
+		return 0, err
+	}
 
 	return db.RowsAffected, nil
 }
 
 // Save 根据 ID 存在与否执行 Create 或 Updated
 func (r *Repo[T, K]) Save(t *T) (K, error) {
+	var k K
+	err := r.intercept(OpSave, []*T{t}, &k, func(c *Repo[T, K]) (err error) {
+		k, err = c.save(t)
+		return err
+	})
+	return k, err
+}
+
+func (r *Repo[T, K]) save(t *T) (K, error) {
 	var zeroK K
 	if t == nil {
 		return zeroK, fmt.Errorf("save param t cannot be nil")
@@ -497,88 +907,292 @@ func (r *Repo[T, K]) Save(t *T) (K, error) {
 
 // Update 部分字段更新
 func (r *Repo[T, K]) Update() (int64, error) {
+	var n int64
+	err := r.intercept(OpUpdate, nil, &n, func(c *Repo[T, K]) (err error) {
+		n, err = c.update()
+		return err
+	})
+	return n, err
+}
+
+func (r *Repo[T, K]) update() (int64, error) {
+	if r.sharded() {
+		return r.shardWrite((*Repo[T, K]).Update)
+	}
+	if r.writeTxNeeded() {
+		return r.inWriteTx((*Repo[T, K]).update)
+	}
 	newRepo := r.cloneInternal()
-	sql, args := newRepo.match.WhereSql()
+	if err := newRepo.checkTenantSets(); err != nil {
+		return 0, err
+	}
+	db, err := newRepo.writeDB()
+	if err != nil {
+		return 0, err
+	}
+	match, err := newRepo.blindMatch(db, &newRepo.match)
+	if err != nil {
+		return 0, err
+	}
+	sql, args := match.WhereSql()
 	updateMap := newRepo.match.SetMap()
-	db := newRepo.db.Model(new(T)).Omit(newRepo.omits...)
+	if err := newRepo.stampUpdateSets(db, updateMap); err != nil {
+		return 0, err
+	}
+	db = db.Model(new(T)).Omit(newRepo.omits...)
 
 	if sql != "" {
 		db = db.Where(sql, args...)
 	}
+	if scopeSql, scopeArgs := newRepo.ScopeMatch().WhereSql(); scopeSql != "" {
+		db = db.Where(scopeSql, scopeArgs...)
+	}
 
+	ids, err := newRepo.matchedIDs(db)
+	if err != nil {
+		return 0, err
+	}
+	if newRepo.cfg.ChangeLog == CaptureHooks && newRepo.tenantColumn != "" && newRepo.acrossTenants && len(ids) != 0 {
+		if newRepo.deletedTenants, err = newRepo.tenantsOf(ids); err != nil {
+			return 0, err
+		}
+	}
+	before, err := newRepo.auditBefore(db)
+	if err != nil {
+		return 0, err
+	}
 	result := db.Updates(updateMap)
 	if result.Error != nil {
 		return 0, result.Error
 	}
+	newRepo.invalidate(ids...)
+	if err := newRepo.auditAfter(OpUpdate, before); err != nil {
+		return 0, err
+	}
+	if result.RowsAffected > 0 {
+		if err := newRepo.emit(OpUpdate, ids, nil, newRepo.setFields()); err != nil {
+			return 0, err
+		}
+	}
 	return result.RowsAffected, nil
 }
 
 // UpdateFull 用结构体全字段更新
 func (r *Repo[T, K]) UpdateFull(t *T) (int64, error) {
-	newRepo := r.cloneInternal()
+	var n int64
+	err := r.intercept(OpUpdateFull, []*T{t}, &n, func(c *Repo[T, K]) (err error) {
+		n, err = c.updateFull(t)
+		return err
+	})
+	return n, err
+}
+
+func (r *Repo[T, K]) updateFull(t *T) (int64, error) {
+	if r.sharded() && t != nil {
+		return r.shardUpdateFull(t)
+	}
+	if r.writeTxNeeded() && t != nil {
+		return r.inWriteTx(func(c *Repo[T, K]) (int64, error) { return c.updateFull(t) })
+	}
+	if t == nil {
+		return 0, fmt.Errorf("update full param t cannot be nil")
+	}
+	// 按全部主键列定位记录，GORM 默认会跳过零值主键列
+	newRepo, err := r.whereKey((*t).GetID())
+	if err != nil {
+		return 0, err
+	}
+	db, err := newRepo.writeDB()
+	if err != nil {
+		return 0, err
+	}
+	if err := newRepo.stampTenantIfScoped(db, t); err != nil {
+		return 0, err
+	}
+	if err := newRepo.stampUpdated(db, t); err != nil {
+		return 0, err
+	}
 	sql, args := newRepo.match.WhereSql()
-	db := newRepo.db.Model(t).Omit(newRepo.omits...)
+	db = db.Model(t).Omit(newRepo.omits...)
 	if sql != "" {
 		db = db.Where(sql, args...)
 	}
+	before, err := newRepo.auditImages([]K{(*t).GetID()})
+	if err != nil {
+		return 0, err
+	}
 	result := db.Updates(t)
 	if result.Error != nil {
 		return 0, result.Error
 	}
+	newRepo.invalidate((*t).GetID())
+	if err := newRepo.auditAfter(OpUpdateFull, before); err != nil {
+		return 0, err
+	}
+	if result.RowsAffected > 0 {
+		if err := newRepo.emit(OpUpdateFull, []K{(*t).GetID()}, []*T{t}, nil); err != nil {
+			return 0, err
+		}
+	}
 	return result.RowsAffected, nil
 }
 
 // Del 删除
 func (r *Repo[T, K]) Del() (int64, error) {
+	var n int64
+	err := r.intercept(OpDel, nil, &n, func(c *Repo[T, K]) (err error) {
+		n, err = c.del()
+		return err
+	})
+	return n, err
+}
+
+func (r *Repo[T, K]) del() (int64, error) {
+	if r.sharded() {
+		return r.shardWrite((*Repo[T, K]).Del)
+	}
+	if r.writeTxNeeded() {
+		return r.inWriteTx((*Repo[T, K]).del)
+	}
 	newRepo := r.cloneInternal()
-	sql, args := newRepo.match.WhereSql()
-	if sql == "" {
+	if len(newRepo.match.Clauses) == 0 {
 		return 0, fmt.Errorf("delete operation requires a condition")
 	}
-	db := newRepo.db.Model(new(T)).Where(sql, args...)
-	result := db.Delete(new(T))
+	db, err := newRepo.writeDB()
+	if err != nil {
+		return 0, err
+	}
+	match, err := newRepo.blindMatch(db, &newRepo.match)
+	if err != nil {
+		return 0, err
+	}
+	sql, args := match.WhereSql()
+	db = db.Model(new(T)).Where(sql, args...)
+	if scopeSql, scopeArgs := newRepo.ScopeMatch().WhereSql(); scopeSql != "" {
+		db = db.Where(scopeSql, scopeArgs...)
+	}
+	ids, err := newRepo.matchedIDs(db)
+	if err != nil {
+		return 0, err
+	}
+	before, err := newRepo.auditBefore(db)
+	if err != nil {
+		return 0, err
+	}
+	column, actor, err := newRepo.deletedByColumn(db)
+	if err != nil {
+		return 0, err
+	}
+	var result *gorm.DB
+	if column == "" {
+		result = db.Delete(new(T))
+	} else {
+		// 软删除前以相同条件写入 deleted_by，两条语句在同一事务中执行
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.UpdateColumn(column, actor).Error; err != nil {
+				return err
+			}
+			result = tx.Delete(new(T))
+			return result.Error
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
 	if result.Error != nil {
 		return 0, result.Error
 	}
+	newRepo.invalidate(ids...)
+	if err := newRepo.auditAfter(OpDel, before); err != nil {
+		return 0, err
+	}
+	if result.RowsAffected > 0 {
+		if err := newRepo.emit(OpDel, ids, nil, nil); err != nil {
+			return 0, err
+		}
+	}
 	return result.RowsAffected, nil
 }
 
 // endregion IRepo Operators Impl
 
 // region IRepo Query Impl
-func (r *Repo[T, K]) supportQuery() *Repo[T, K] {
+func (r *Repo[T, K]) supportQuery() (*Repo[T, K], error) {
 	c := r.cloneInternal()
-	c.db = c.db.Model(new(T))
+	if c.raw != nil {
+		if err := c.checkRawTenant(); err != nil {
+			return nil, err
+		}
+	}
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	// 已解析出具体连接，后续在该连接上继续构建
+	c.bound = true
+	c.db = db.Model(new(T))
+	if c.raw != nil {
+		c.db = c.db.Raw(c.raw.sql, c.raw.args...)
+		return c, nil
+	}
+	scope := c.qualify(c.ScopeMatch())
+	if sql, args := scope.WhereSql(); sql != "" {
+		c.db = c.db.Where(sql, args...)
+	}
+	c.db = c.applyRelations(c.db)
 	if c.isRaw {
-		return c
+		return c, nil
+	}
+	blind, err := c.blindMatch(c.db, &c.match)
+	if err != nil {
+		return nil, err
 	}
-	db := c.db.Select(c.selects).Omit(c.omits...)
-	sql, args := c.match.WhereSql()
+	db = c.db.Select(c.qualifyFields(c.selects)).Omit(c.omits...)
+	match := c.qualify(blind)
+	sql, args := match.WhereSql()
 	if sql != "" {
 		db = db.Where(sql, args...)
 	}
-	orders := c.match.OrderSql()
+	orders := match.OrderSql()
 	if orders != "" {
 		db = db.Order(orders)
 	}
+	if scopeOrders := scope.OrderSql(); scopeOrders != "" {
+		db = db.Order(scopeOrders)
+	}
 	if c.limit > 0 {
 		db = db.Limit(int(c.limit))
 	}
 	c.db = db
-	return c
+	return c, nil
 }
 
 // Raw 执行原生 SQL 查询
 func (r *Repo[T, K]) Raw(sql string, args ...any) IRawQueryRepo[T, K] {
 	newRepo := r.cloneInternal()
-	// 绑定模型 T 到原生查询
-	newRepo.db = newRepo.db.Model(new(T)).Raw(sql, args...)
+	// 绑定模型 T 到原生查询，执行时构建
+	newRepo.raw = &rawExpr{sql: sql, args: args}
 	newRepo.isRaw = true
 	return newRepo
 }
 
 func (r *Repo[T, K]) Get() (*T, error) {
-	c := r.supportQuery()
+	var t *T
+	err := r.intercept(OpGet, nil, &t, func(c *Repo[T, K]) (err error) {
+		t, err = c.get()
+		return err
+	})
+	return t, err
+}
+
+func (r *Repo[T, K]) get() (*T, error) {
+	if r.sharded() {
+		return r.shardGet()
+	}
+	c, err := r.supportQuery()
+	if err != nil {
+		return nil, err
+	}
 	var models []T
 	if c.isRaw {
 		err := c.db.Scan(&models).Error
@@ -589,9 +1203,12 @@ func (r *Repo[T, K]) Get() (*T, error) {
 		} else if len(models) > 1 {
 			return nil, errors.New(fmt.Sprintf("%s: raw query found more than one record", c.key))
 		}
+		if err := c.decryptRaw(c.db, models); err != nil {
+			return nil, err
+		}
 		return &models[0], nil
 	}
-	err := c.db.Find(&models).Error
+	err = c.db.Find(&models).Error
 
 	if err != nil {
 		return nil, err
@@ -604,7 +1221,14 @@ func (r *Repo[T, K]) Get() (*T, error) {
 }
 
 func (r *Repo[T, K]) GetByID(id K) (*T, error) {
-	return r.Eq("id", id).Get()
+	if cache, ok := r.readCache(); ok {
+		return r.cachedGet(cache, id)
+	}
+	newRepo, err := r.whereKey(id)
+	if err != nil {
+		return nil, err
+	}
+	return newRepo.Get()
 }
 
 func (r *Repo[T, K]) GetOrInit() (*T, error) {
@@ -622,15 +1246,33 @@ func (r *Repo[T, K]) GetOrInit() (*T, error) {
 
 func (r *Repo[T, K]) List() ([]T, error) {
 	var list []T
-	if r.isRaw {
-		err := r.db.Scan(&list).Error
+	err := r.intercept(OpList, nil, &list, func(c *Repo[T, K]) (err error) {
+		list, err = c.list()
+		return err
+	})
+	return list, err
+}
+
+func (r *Repo[T, K]) list() ([]T, error) {
+	if r.cacheTTL > 0 {
+		return cachedResult(r, "list", (*Repo[T, K]).List, slices.Clone[[]T])
+	}
+	if r.sharded() {
+		return r.shardList()
+	}
+	var list []T
+	newRepo, err := r.supportQuery()
+	if err != nil {
+		return nil, err
+	}
+	if newRepo.isRaw {
+		err := newRepo.db.Scan(&list).Error
 		if err != nil {
 			return nil, err
 		}
-		return list, nil
+		return list, newRepo.decryptRaw(newRepo.db, list)
 	}
-	newRepo := r.supportQuery()
-	err := newRepo.db.Find(&list).Error
+	err = newRepo.db.Find(&list).Error
 	if err != nil {
 		return list, err
 	}
@@ -644,14 +1286,37 @@ func (r *Repo[T, K]) WithPage(page *Page) IRepo[T, K] {
 }
 
 func (r *Repo[T, K]) Page() (*Page, error) {
-	newRepo := r.supportQuery()
+	var page *Page
+	err := r.intercept(OpPage, nil, &page, func(c *Repo[T, K]) (err error) {
+		page, err = c.pageQuery()
+		return err
+	})
+	return page, err
+}
+
+func (r *Repo[T, K]) pageQuery() (*Page, error) {
+	if r.cacheTTL > 0 {
+		return cachedResult(r, "page", (*Repo[T, K]).Page, func(p *Page) *Page {
+			res := *p
+			res.Result = slices.Clone(p.Result)
+			return &res
+		})
+	}
+	if r.sharded() {
+		page, list, total, err := r.shardPage()
+		return &Page{Page: page.Page, Size: page.Size, Total: total, Result: ToAnySlice(list)}, err
+	}
+	newRepo, err := r.supportQuery()
+	if err != nil {
+		return nil, err
+	}
 	if newRepo.page == nil {
 		newRepo.page = &Page{Page: 1, Size: 10}
 	}
 	offset := (newRepo.page.Page - 1) * newRepo.page.Size
 	var list []T
 	var count int64
-	err := newRepo.db.Count(&count).Error
+	err = newRepo.db.Count(&count).Error
 	if err != nil {
 		return &Page{Page: newRepo.page.Page, Size: newRepo.page.Size, Total: 0, Result: nil}, err
 	}
@@ -672,14 +1337,37 @@ func (r *Repo[T, K]) PageM(size int64, page int64) (*Page, error) {
 }
 
 func (r *Repo[T, K]) PageT() (*PageT[T], error) {
-	newRepo := r.supportQuery()
+	var page *PageT[T]
+	err := r.intercept(OpPage, nil, &page, func(c *Repo[T, K]) (err error) {
+		page, err = c.pageT()
+		return err
+	})
+	return page, err
+}
+
+func (r *Repo[T, K]) pageT() (*PageT[T], error) {
+	if r.cacheTTL > 0 {
+		return cachedResult(r, "paget", (*Repo[T, K]).PageT, func(p *PageT[T]) *PageT[T] {
+			res := *p
+			res.Result = slices.Clone(p.Result)
+			return &res
+		})
+	}
+	if r.sharded() {
+		page, list, total, err := r.shardPage()
+		return &PageT[T]{Page: page.Page, Size: page.Size, Total: total, Result: list}, err
+	}
+	newRepo, err := r.supportQuery()
+	if err != nil {
+		return nil, err
+	}
 	if newRepo.page == nil {
 		newRepo.page = &Page{Page: 1, Size: 10}
 	}
 	var list []T
 	var count int64
 
-	err := newRepo.db.Count(&count).Error
+	err = newRepo.db.Count(&count).Error
 	if err != nil {
 		return &PageT[T]{Page: newRepo.page.Page, Size: newRepo.page.Size, Total: 0, Result: nil}, err
 	}
@@ -702,9 +1390,18 @@ func (r *Repo[T, K]) PageMT(size int64, page int64) (*PageT[T], error) {
 }
 
 func (r *Repo[T, K]) Count() (int64, error) {
-	newRepo := r.supportQuery()
+	if r.cacheTTL > 0 {
+		return cachedResult(r, "count", (*Repo[T, K]).Count, func(n int64) int64 { return n })
+	}
+	if r.sharded() {
+		return r.shardCount()
+	}
+	newRepo, err := r.supportQuery()
+	if err != nil {
+		return 0, err
+	}
 	var count int64
-	err := newRepo.DB().Count(&count).Error
+	err = newRepo.db.Count(&count).Error
 	if err != nil {
 		return 0, err
 	}
@@ -713,8 +1410,14 @@ func (r *Repo[T, K]) Count() (int64, error) {
 
 // Scan 扫描结果到目标对象
 func (r *Repo[T, K]) Scan(dest any) error {
-	newRepo := r.cloneInternal()
-	err := newRepo.db.Scan(dest).Error
+	if r.sharded() {
+		return r.shardScan(dest)
+	}
+	newRepo, err := r.supportQuery()
+	if err != nil {
+		return err
+	}
+	err = newRepo.db.Scan(dest).Error
 	if err != nil {
 		return err
 	}
@@ -1,12 +1,18 @@
 package db_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
-	"dubhe/db"
+	"github.com/xiaojiecode/dubhe/db"
+	"github.com/xiaojiecode/dubhe/db/ds"
 )
 
 // ---------- 测试模型 ----------
@@ -26,13 +32,30 @@ func (u User) RepoDefine() db.RepoCfg {
 var testDB *gorm.DB
 
 func TestMain(m *testing.M) {
-	var err error
-	testDB, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	// 使用临时文件而非 :memory:，连接池新建的连接看到的是同一个库
+	dir, err := os.MkdirTemp("", "dubhe-db-test")
+	if err != nil {
+		panic(err)
+	}
+	testDB, err = gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")+"?_journal_mode=WAL&_busy_timeout=5000"), &gorm.Config{})
 	if err != nil {
 		panic(err)
 	}
 	_ = testDB.AutoMigrate(&User{})
-	m.Run()
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// cleanTables 测试结束后清空 tables（含软删除的行），使重复运行（-count）互不影响；
+// 自增序列不重置，新行不会命中上一轮遗留的实体缓存
+func cleanTables(t *testing.T, tables ...string) {
+	t.Helper()
+	t.Cleanup(func() {
+		for _, table := range tables {
+			testDB.Exec("DELETE FROM " + table)
+		}
+	})
 }
 
 // ---------- 单元测试 ----------
@@ -143,6 +166,7 @@ func TestCreateBatch(t *testing.T) {
 }
 func TestClauseGet(t *testing.T) {
 	repo := db.NewRepo[User, int64]()
+	testDB.Exec("DELETE FROM users")
 	batch, err := repo.CreateBatch([]*User{
 		{Name: "Dave", Age: 40},
 		{Name: "Bob", Age: 30},
@@ -161,3 +185,119 @@ func TestClauseGet(t *testing.T) {
 	}
 
 }
+
+type Note struct {
+	db.ModelI64
+	Text string
+}
+
+func (Note) TableName() string { return "notes" }
+func (Note) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DataSource: "rw_test", AutoMigrate: true}
+}
+
+func TestRepoReadWriteSplit(t *testing.T) {
+	dir := t.TempDir()
+	err := ds.RegisterDataSource("rw_test", ds.DBConfig{
+		DSN:      filepath.Join(dir, "primary.db"),
+		Driver:   "sqlite",
+		LogLevel: logger.Silent,
+		Replicas: []string{filepath.Join(dir, "replica.db")},
+	})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	t.Cleanup(func() { _ = ds.Unregister("rw_test") })
+	// 模板按表缓存，重复运行时不会再对新注册的数据源迁移
+	primary, _ := ds.GetDB("rw_test")
+	_ = primary.AutoMigrate(&Note{})
+	replica := ds.Replicas("rw_test")[0]
+	_ = replica.AutoMigrate(&Note{})
+	replica.Create(&Note{Text: "from replica"})
+
+	repo := db.NewRepo[Note, int64]()
+	if _, err := repo.Create(&Note{Text: "from primary"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	// 读走从库
+	list, err := repo.List()
+	if err != nil || len(list) != 1 || list[0].Text != "from replica" {
+		t.Fatalf("read should hit replica: %v, %+v", err, list)
+	}
+	// Primary 强制走主库
+	list, err = repo.Primary().List()
+	if err != nil || len(list) != 1 || list[0].Text != "from primary" {
+		t.Fatalf("primary read failed: %v, %+v", err, list)
+	}
+	// 事务内读写都走主库
+	tx := repo.Begin()
+	n, err := tx.Eq("text", "from primary").Count()
+	_ = tx.Rollback()
+	if err != nil || n != 1 {
+		t.Fatalf("tx read should hit primary: %v, %d", err, n)
+	}
+}
+
+type TenantNote struct {
+	db.ModelI64
+	Text string
+}
+
+var tenantResolver = ds.NewTenantResolver(func(tenant string) (ds.DBConfig, error) {
+	return ds.DBConfig{DSN: "file:" + tenant + "?mode=memory&cache=shared", Driver: "sqlite", LogLevel: logger.Silent}, nil
+}, 8)
+
+func (TenantNote) TableName() string { return "tenant_notes" }
+func (TenantNote) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{Resolver: tenantResolver}
+}
+
+func TestRepoTenantResolver(t *testing.T) {
+	defer func() { _ = tenantResolver.Close() }()
+
+	repo := db.NewRepo[TenantNote, int64]()
+	ctxA := ds.WithTenant(context.Background(), "repo_tenant_a")
+	ctxB := ds.WithTenant(context.Background(), "repo_tenant_b")
+
+	if _, err := repo.WithCtx(&ctxA).Create(&TenantNote{Text: "a"}); err != nil {
+		t.Fatalf("create for tenant a failed: %v", err)
+	}
+	if n, err := repo.WithCtx(&ctxB).Count(); err != nil || n != 0 {
+		t.Fatalf("tenant b should be empty: %v, %d", err, n)
+	}
+	list, err := repo.WithCtx(&ctxA).Eq("text", "a").List()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("tenant a list failed: %v, %+v", err, list)
+	}
+
+	// 事务绑定到解析出的租户连接
+	tx := repo.WithCtx(&ctxB).Begin()
+	_, _ = tx.Create(&TenantNote{Text: "b"})
+	_ = tx.Commit()
+	if n, _ := repo.WithCtx(&ctxB).Count(); n != 1 {
+		t.Fatalf("tenant b should have one record, got %d", n)
+	}
+
+	// 上下文中没有租户时报错
+	if _, err := repo.List(); err == nil {
+		t.Fatal("expected error without tenant")
+	}
+
+	// 无法解析连接时事务 Repo 不 panic，错误由之后的操作与 Commit/Rollback 返回
+	for _, tx := range []db.IRepo[TenantNote, int64]{repo.Begin(), repo.Tx()} {
+		if _, err := tx.Create(&TenantNote{Text: "none"}); !errors.Is(err, ds.ErrNoTenant) {
+			t.Fatalf("expected ErrNoTenant from tx operation, got %v", err)
+		}
+		if err := tx.Commit(); !errors.Is(err, ds.ErrNoTenant) {
+			t.Fatalf("expected ErrNoTenant from commit, got %v", err)
+		}
+		if err := tx.Rollback(); !errors.Is(err, ds.ErrNoTenant) {
+			t.Fatalf("expected ErrNoTenant from rollback, got %v", err)
+		}
+		txCtx := db.TxContext(context.Background(), tx)
+		if err := db.OnCommit(txCtx, func() {}); !errors.Is(err, ds.ErrNoTenant) {
+			t.Fatalf("expected ErrNoTenant from OnCommit, got %v", err)
+		}
+	}
+}
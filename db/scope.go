@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+)
+
+// Scope 全局作用域：对模型的所有查询、Update、Del 自动追加条件，
+// 通过 clause.Match 描述，便于检查与测试
+type Scope struct {
+	Name  string                                     // 作用域名称，用于 WithoutScope 排除
+	Apply func(m *clause.Match, ctx context.Context) // 向 Match 追加条件（或排序）
+}
+
+// Scoped 模型级全局作用域，与 RepoCfg.Scopes 合并生效
+type Scoped interface {
+	Scopes() []Scope
+}
+
+// scopesOf 合并 RepoCfg 与模型声明的全局作用域
+func scopesOf(model any, cfg RepoCfg) []Scope {
+	scopes := slices.Clone(cfg.Scopes)
+	if scoped, ok := model.(Scoped); ok {
+		scopes = append(scopes, scoped.Scopes()...)
+	}
+	return scopes
+}
+
+// WithoutScope 本次操作排除指定名称的全局作用域，返回新的 Repo 实例
+func (r *Repo[T, K]) WithoutScope(names ...string) IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.skipScopes = append(newRepo.skipScopes, names...)
+	return newRepo
+}
+
+// ScopeMatch 返回当前生效的全局作用域生成的条件
+func (r *Repo[T, K]) ScopeMatch() *clause.Match {
+	m := clause.NewMatch()
+	for _, s := range r.scopes {
+		if s.Apply == nil || slices.Contains(r.skipScopes, s.Name) {
+			continue
+		}
+		s.Apply(m, r.context())
+	}
+	return m
+}
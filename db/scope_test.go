@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"github.com/xiaojiecode/dubhe/db/clause"
+)
+
+type regionKey struct{}
+
+type Product struct {
+	db.ModelI64
+	Name   string
+	Status string
+	Region string
+}
+
+func (Product) TableName() string { return "products" }
+func (Product) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Scopes: []db.Scope{{
+		Name:  "not_archived",
+		Apply: func(m *clause.Match, _ context.Context) { m.NEq("status", "archived") },
+	}}}
+}
+
+// Scopes 模型级作用域：按上下文中的区域过滤
+func (Product) Scopes() []db.Scope {
+	return []db.Scope{{
+		Name: "region",
+		Apply: func(m *clause.Match, ctx context.Context) {
+			if region, ok := ctx.Value(regionKey{}).(string); ok {
+				m.Eq("region", region)
+			}
+		},
+	}}
+}
+
+func TestGlobalScopes(t *testing.T) {
+	cleanTables(t, "products")
+	repo := db.NewRepo[Product, int64]()
+	_, _ = repo.CreateBatch([]*Product{
+		{Name: "p1", Status: "active", Region: "eu"},
+		{Name: "p2", Status: "archived", Region: "eu"},
+		{Name: "p3", Status: "active", Region: "us"},
+	})
+
+	if n, _ := repo.Count(); n != 2 {
+		t.Fatalf("archived products should be hidden, got %d", n)
+	}
+	ctx := context.WithValue(context.Background(), regionKey{}, "eu")
+	list, err := repo.WithCtx(&ctx).List()
+	if err != nil || len(list) != 1 || list[0].Name != "p1" {
+		t.Fatalf("region scope failed: %v, %+v", err, list)
+	}
+	if n, _ := repo.WithCtx(&ctx).WithoutScope("not_archived").Count(); n != 2 {
+		t.Fatalf("without scope should include archived, got %d", n)
+	}
+	sql, args := repo.WithCtx(&ctx).ScopeMatch().WhereSql()
+	if sql != " status <> ? AND region = ?" || len(args) != 2 {
+		t.Fatalf("unexpected scope match: %q %v", sql, args)
+	}
+
+	// Update、Del 同样应用作用域
+	if n, _ := repo.Set("name", "x").NotNull("id").Update(); n != 2 {
+		t.Fatalf("update should skip archived, got %d", n)
+	}
+	if n, _ := repo.Eq("name", "x").Del(); n != 2 {
+		t.Fatalf("delete should skip archived, got %d", n)
+	}
+	if n, _ := repo.WithoutScope("not_archived").Count(); n != 1 {
+		t.Fatalf("archived product should remain, got %d", n)
+	}
+}
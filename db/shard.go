@@ -0,0 +1,555 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db/clause"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrUnroutable 写操作无法根据分片键定位到分片表
+var ErrUnroutable = errors.New("sharded write requires an Eq/In condition on the shard key, or AllShards()")
+
+// Sharding 水平分表配置
+type Sharding struct {
+	Key      string        // 分片键列名，如 "user_id"
+	Strategy ShardStrategy // 分片策略
+}
+
+// ShardStrategy 分片策略：根据分片键值计算表名，并列出全部分片表
+type ShardStrategy interface {
+	// Route 返回分片键值对应的表名
+	Route(table string, value any) (string, error)
+	// Tables 返回全部分片表名，用于扇出查询与自动迁移
+	Tables(table string) []string
+}
+
+// region Strategies
+
+type modShard struct {
+	n int
+}
+
+// ModShard 取模分片：整数键按值取模，其它类型按 FNV 哈希取模，表名如 events_00 … events_63
+func ModShard(n int) ShardStrategy {
+	if n <= 0 {
+		panic("shard count must be positive")
+	}
+	return modShard{n: n}
+}
+
+func (s modShard) Route(table string, value any) (string, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", fmt.Errorf("shard key is nil")
+		}
+		v = v.Elem()
+	}
+	var idx uint64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			i = -i
+		}
+		idx = uint64(i) % uint64(s.n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		idx = v.Uint() % uint64(s.n)
+	default:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(fmt.Sprint(v.Interface())))
+		idx = h.Sum64() % uint64(s.n)
+	}
+	return shardName(table, int(idx), s.n), nil
+}
+
+func (s modShard) Tables(table string) []string {
+	res := make([]string, s.n)
+	for i := range res {
+		res[i] = shardName(table, i, s.n)
+	}
+	return res
+}
+
+type rangeShard struct {
+	bounds []int64
+}
+
+// RangeShard 范围分片：bounds 为递增的上界（不含），第 i 个分片覆盖 [bounds[i-1], bounds[i])，
+// 例如 RangeShard(1000000, 2000000) 产生 events_00、events_01 两张表
+func RangeShard(bounds ...int64) ShardStrategy {
+	if len(bounds) == 0 || !slices.IsSorted(bounds) {
+		panic("range shard bounds must be non-empty and ascending")
+	}
+	return rangeShard{bounds: bounds}
+}
+
+func (s rangeShard) Route(table string, value any) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	var i int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i = int64(v.Uint())
+	default:
+		return "", fmt.Errorf("range shard key must be an integer, got %T", value)
+	}
+	idx := sort.Search(len(s.bounds), func(n int) bool { return i < s.bounds[n] })
+	if idx == len(s.bounds) {
+		return "", fmt.Errorf("shard key %d out of range", i)
+	}
+	return shardName(table, idx, len(s.bounds)), nil
+}
+
+func (s rangeShard) Tables(table string) []string {
+	res := make([]string, len(s.bounds))
+	for i := range res {
+		res[i] = shardName(table, i, len(s.bounds))
+	}
+	return res
+}
+
+type monthlyShard struct {
+	from time.Time
+	to   time.Time
+}
+
+// MonthlyShard 按月分表，表名如 events_202601；扇出查询覆盖 from 至 to 的月份，to 为零值时截止到当前月。
+// from 不能为零值（否则扇出自公元 1 年起的全部月份），to 不能早于 from
+func MonthlyShard(from, to time.Time) ShardStrategy {
+	if from.IsZero() {
+		panic("monthly shard requires a non-zero from")
+	}
+	if !to.IsZero() && to.Before(from) {
+		panic("monthly shard to must not be before from")
+	}
+	return monthlyShard{from: from, to: to}
+}
+
+func (s monthlyShard) Route(table string, value any) (string, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return "", fmt.Errorf("shard key is nil")
+		}
+		t = *v
+	default:
+		return "", fmt.Errorf("monthly shard key must be time.Time, got %T", value)
+	}
+	if t.IsZero() {
+		return "", fmt.Errorf("shard key is zero time")
+	}
+	return table + "_" + t.Format("200601"), nil
+}
+
+func (s monthlyShard) Tables(table string) []string {
+	to := s.to
+	if to.IsZero() {
+		to = time.Now()
+	}
+	var res []string
+	for m := time.Date(s.from.Year(), s.from.Month(), 1, 0, 0, 0, 0, s.from.Location()); !m.After(to); m = m.AddDate(0, 1, 0) {
+		res = append(res, table+"_"+m.Format("200601"))
+	}
+	return res
+}
+
+func shardName(table string, idx, n int) string {
+	width := len(fmt.Sprint(n - 1))
+	if width < 2 {
+		width = 2
+	}
+	return fmt.Sprintf("%s_%0*d", table, width, idx)
+}
+
+// endregion Strategies
+
+// region Repo Sharding
+
+// AllShards 允许无法按分片键定位的 Update/Del 扇出到全部分片表，返回新的 Repo 实例
+func (r *Repo[T, K]) AllShards() IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.allShards = true
+	return newRepo
+}
+
+// sharded 是否需要按分片处理（已定位到具体分片表或原生 SQL 时不再处理）
+func (r *Repo[T, K]) sharded() bool {
+	return r.cfg.Sharding != nil && r.shardTable == "" && r.raw == nil
+}
+
+// onTable 返回定位到指定分片表的副本
+func (r *Repo[T, K]) onTable(table string) *Repo[T, K] {
+	c := r.cloneInternal()
+	c.shardTable = table
+	return c
+}
+
+// shardTargets 根据分片键上的 Eq/In 条件计算目标分片表，routed 为 false 表示需要扇出到全部分片
+func (r *Repo[T, K]) shardTargets() (tables []string, routed bool, err error) {
+	sharding := r.cfg.Sharding
+	for _, c := range r.match.Clauses {
+		if c.Field != sharding.Key {
+			continue
+		}
+		switch c.Op {
+		case clause.OpEq:
+			table, err := sharding.Strategy.Route(r.table, c.Value)
+			if err != nil {
+				return nil, false, err
+			}
+			return []string{table}, true, nil
+		case clause.OpIn:
+			v := reflect.ValueOf(c.Value)
+			if v.Kind() != reflect.Slice {
+				continue
+			}
+			for i := 0; i < v.Len(); i++ {
+				table, err := sharding.Strategy.Route(r.table, v.Index(i).Interface())
+				if err != nil {
+					return nil, false, err
+				}
+				if !slices.Contains(tables, table) {
+					tables = append(tables, table)
+				}
+			}
+			return tables, true, nil
+		}
+	}
+	return sharding.Strategy.Tables(r.table), false, nil
+}
+
+// entityShardTable 根据实体的分片键字段计算分片表
+func (r *Repo[T, K]) entityShardTable(db *gorm.DB, t *T) (string, error) {
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return "", err
+	}
+	field := sch.LookUpField(r.cfg.Sharding.Key)
+	if field == nil {
+		return "", fmt.Errorf("%s: shard key %s not found", r.key, r.cfg.Sharding.Key)
+	}
+	value, _ := field.ValueOf(r.context(), reflect.ValueOf(t).Elem())
+	return r.cfg.Sharding.Strategy.Route(r.table, value)
+}
+
+// migrateShards 自动迁移全部分片表
+func (r *Repo[T, K]) migrateShards(db *gorm.DB) error {
+	for _, table := range r.cfg.Sharding.Strategy.Tables(r.table) {
+		if err := r.migrateShard(db, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateShard 按需迁移单个分片表（如按月分表的新月份）
+func (r *Repo[T, K]) migrateShard(db *gorm.DB, table string) error {
+	if !r.autoMigrate {
+		return nil
+	}
+	key := shardMigrateKey{config: db.Config, table: table}
+	if _, loaded := r.migrated.LoadOrStore(key, struct{}{}); loaded {
+		return nil
+	}
+	if err := db.Table(table).AutoMigrate(r.model); err != nil {
+		r.migrated.Delete(key)
+		return err
+	}
+	return nil
+}
+
+// shardMigrateKey 分片表迁移记录，按 gorm.Config 区分连接（同一连接的会话与事务共享 Config）
+type shardMigrateKey struct {
+	config *gorm.Config
+	table  string
+}
+
+func (r *Repo[T, K]) shardCreate(t *T) (K, error) {
+	var k K
+	db, err := r.conn()
+	if err != nil {
+		return k, err
+	}
+	table, err := r.entityShardTable(db, t)
+	if err != nil {
+		return k, err
+	}
+	if err := r.migrateShard(db, table); err != nil {
+		return k, err
+	}
+	return r.onTable(table).Create(t)
+}
+
+func (r *Repo[T, K]) shardCreateBatch(ts []*T) (int64, error) {
+	db, err := r.conn()
+	if err != nil {
+		return 0, err
+	}
+	groups := make(map[string][]*T)
+	var order []string
+	for _, t := range ts {
+		table, err := r.entityShardTable(db, t)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := groups[table]; !ok {
+			order = append(order, table)
+		}
+		groups[table] = append(groups[table], t)
+	}
+	var total int64
+	for _, table := range order {
+		if err := r.migrateShard(db, table); err != nil {
+			return total, err
+		}
+		n, err := r.onTable(table).CreateBatch(groups[table])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *Repo[T, K]) shardUpdateFull(t *T) (int64, error) {
+	db, err := r.conn()
+	if err != nil {
+		return 0, err
+	}
+	table, err := r.entityShardTable(db, t)
+	if err != nil {
+		return 0, err
+	}
+	return r.onTable(table).UpdateFull(t)
+}
+
+// shardWrite 对目标分片执行写操作并累加影响行数，无法定位且未允许扇出时拒绝执行
+func (r *Repo[T, K]) shardWrite(fn func(*Repo[T, K]) (int64, error)) (int64, error) {
+	tables, routed, err := r.shardTargets()
+	if err != nil {
+		return 0, err
+	}
+	if !routed && !r.allShards {
+		return 0, fmt.Errorf("%s: %w", r.key, ErrUnroutable)
+	}
+	var total int64
+	for _, table := range tables {
+		n, err := fn(r.onTable(table))
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// shardGet 扇出查询单条记录，多个分片命中时与单表一致返回错误
+func (r *Repo[T, K]) shardGet() (*T, error) {
+	c := r.cloneInternal()
+	c.limit = 2
+	list, err := c.shardList()
+	if err != nil {
+		return nil, err
+	}
+	switch len(list) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &list[0], nil
+	default:
+		return nil, fmt.Errorf("%s: query found more than one record", r.key)
+	}
+}
+
+// shardScan 仅支持定位到单个分片表的查询
+func (r *Repo[T, K]) shardScan(dest any) error {
+	tables, _, err := r.shardTargets()
+	if err != nil {
+		return err
+	}
+	if len(tables) != 1 {
+		return fmt.Errorf("%s: scan on sharded repo requires an Eq condition on the shard key", r.key)
+	}
+	return r.onTable(tables[0]).Scan(dest)
+}
+
+func (r *Repo[T, K]) shardCount() (int64, error) {
+	tables, _, err := r.shardTargets()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, table := range tables {
+		n, err := r.onTable(table).Count()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// shardList 扇出查询并按排序条件归并，limit 在归并后再次截断
+func (r *Repo[T, K]) shardList() ([]T, error) {
+	tables, _, err := r.shardTargets()
+	if err != nil {
+		return nil, err
+	}
+	var list []T
+	for _, table := range tables {
+		part, err := r.onTable(table).List()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, part...)
+	}
+	if len(tables) > 1 {
+		if err := r.sortMerged(list); err != nil {
+			return nil, err
+		}
+		if r.limit > 0 && int64(len(list)) > r.limit {
+			list = list[:r.limit]
+		}
+	}
+	return list, nil
+}
+
+// shardPage 扇出分页：每个分片取前 offset+size 条，归并排序后截取当前页
+func (r *Repo[T, K]) shardPage() (*Page, []T, int64, error) {
+	page := r.page
+	if page == nil {
+		page = &Page{Page: 1, Size: 10}
+	}
+	total, err := r.shardCount()
+	if err != nil {
+		return page, nil, 0, err
+	}
+	offset := (page.Page - 1) * page.Size
+	c := r.cloneInternal()
+	c.limit = offset + page.Size
+	list, err := c.shardList()
+	if err != nil {
+		return page, nil, total, err
+	}
+	if offset >= int64(len(list)) {
+		return page, []T{}, total, nil
+	}
+	end := min(offset+page.Size, int64(len(list)))
+	return page, list[offset:end], total, nil
+}
+
+// sortMerged 按 Match 中的排序条件对多分片结果归并排序
+func (r *Repo[T, K]) sortMerged(list []T) error {
+	if len(r.match.Orders) == 0 || len(list) < 2 {
+		return nil
+	}
+	db, err := r.conn()
+	if err != nil {
+		return err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	fields := make([]*schema.Field, len(r.match.Orders))
+	for i, o := range r.match.Orders {
+		if fields[i] = sch.LookUpField(o.Field); fields[i] == nil {
+			return fmt.Errorf("%s: order field %s not found for merging shards", r.key, o.Field)
+		}
+	}
+	ctx := r.context()
+	sort.SliceStable(list, func(i, j int) bool {
+		vi, vj := reflect.ValueOf(&list[i]).Elem(), reflect.ValueOf(&list[j]).Elem()
+		for n, o := range r.match.Orders {
+			a, _ := fields[n].ValueOf(ctx, vi)
+			b, _ := fields[n].ValueOf(ctx, vj)
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if strings.EqualFold(o.Op, clause.OpDesc) {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// compareValues 比较两个字段值，支持数字、字符串、布尔与时间
+func compareValues(a, b any) int {
+	va, vb := reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b))
+	if !va.IsValid() || !vb.IsValid() {
+		switch {
+		case !va.IsValid() && !vb.IsValid():
+			return 0
+		case !va.IsValid():
+			return -1
+		default:
+			return 1
+		}
+	}
+	if ta, ok := va.Interface().(time.Time); ok {
+		if tb, ok := vb.Interface().(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	switch va.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmpOrdered(va.Int(), vb.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmpOrdered(va.Uint(), vb.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmpOrdered(va.Float(), vb.Float())
+	case reflect.String:
+		return strings.Compare(va.String(), vb.String())
+	case reflect.Bool:
+		return cmpOrdered(boolInt(va.Bool()), boolInt(vb.Bool()))
+	default:
+		return strings.Compare(fmt.Sprint(va.Interface()), fmt.Sprint(vb.Interface()))
+	}
+}
+
+func cmpOrdered[V int64 | uint64 | float64 | int](a, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// endregion Repo Sharding
+
+// parseSchema 解析模型 T 的 gorm schema（gorm 内部有缓存）
+func parseSchema[T any](db *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
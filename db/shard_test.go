@@ -0,0 +1,96 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+type Event struct {
+	db.ModelI64
+	UserID int64
+	Seq    int
+}
+
+func (Event) TableName() string { return "events" }
+func (Event) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Sharding: &db.Sharding{Key: "user_id", Strategy: db.ModShard(4)}}
+}
+
+func TestSharding(t *testing.T) {
+	cleanTables(t, "events_00", "events_01", "events_02", "events_03")
+	repo := db.NewRepo[Event, int64]()
+	var events []*Event
+	for i := 1; i <= 8; i++ {
+		events = append(events, &Event{UserID: int64(i), Seq: i})
+	}
+	if n, err := repo.CreateBatch(events); err != nil || n != 8 {
+		t.Fatalf("create batch failed: %v, %d", err, n)
+	}
+	// 每个分片表两条
+	var n int64
+	testDB.Table("events_01").Count(&n)
+	if n != 2 {
+		t.Fatalf("expected 2 rows in events_01, got %d", n)
+	}
+
+	e, err := repo.Eq("user_id", int64(5)).Get()
+	if err != nil || e == nil || e.Seq != 5 {
+		t.Fatalf("routed get failed: %v, %+v", err, e)
+	}
+	if n, _ := repo.Count(); n != 8 {
+		t.Fatalf("fan-out count expected 8, got %d", n)
+	}
+	list, err := repo.Desc("seq").Limit(3).List()
+	if err != nil || len(list) != 3 || list[0].Seq != 8 || list[2].Seq != 6 {
+		t.Fatalf("merged ordering failed: %v, %+v", err, list)
+	}
+	page, err := repo.Asc("seq").PageMT(3, 2)
+	if err != nil || page.Total != 8 || len(page.Result) != 3 || page.Result[0].Seq != 4 {
+		t.Fatalf("fan-out page failed: %v, %+v", err, page)
+	}
+
+	// 无法路由的写操作默认拒绝
+	if _, err := repo.Gt("seq", 0).Set("seq", 0).Update(); !errors.Is(err, db.ErrUnroutable) {
+		t.Fatalf("expected ErrUnroutable, got %v", err)
+	}
+	if n, err := repo.In("user_id", []int64{1, 2}).Set("seq", 0).Update(); err != nil || n != 2 {
+		t.Fatalf("routed update failed: %v, %d", err, n)
+	}
+	if n, err := repo.AllShards().Eq("seq", 0).Del(); err != nil || n != 2 {
+		t.Fatalf("fan-out delete failed: %v, %d", err, n)
+	}
+}
+
+func TestShardStrategies(t *testing.T) {
+	r := db.RangeShard(100, 200)
+	if table, _ := r.Route("orders", 150); table != "orders_01" {
+		t.Fatalf("range route got %s", table)
+	}
+	if _, err := r.Route("orders", 200); err == nil {
+		t.Fatalf("out of range key should fail")
+	}
+
+	m := db.MonthlyShard(time.Date(2026, 11, 5, 0, 0, 0, 0, time.UTC), time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC))
+	if table, _ := m.Route("logs", time.Date(2027, 1, 9, 0, 0, 0, 0, time.UTC)); table != "logs_202701" {
+		t.Fatalf("monthly route got %s", table)
+	}
+	if tables := m.Tables("logs"); len(tables) != 4 || tables[3] != "logs_202702" {
+		t.Fatalf("monthly tables got %v", tables)
+	}
+
+	// from 为零值或 to 早于 from 时在构造时报错
+	now := time.Now()
+	for _, bounds := range [][2]time.Time{{{}, {}}, {{}, now}, {now, now.AddDate(0, -1, 0)}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("monthly shard %v should panic", bounds)
+				}
+			}()
+			db.MonthlyShard(bounds[0], bounds[1])
+		}()
+	}
+}
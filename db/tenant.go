@@ -0,0 +1,95 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xiaojiecode/dubhe/db/ds"
+	"gorm.io/gorm"
+)
+
+// TenantScoped 共享表多租户模型标记，返回租户列名（优先级高于 RepoCfg.TenantColumn）
+type TenantScoped interface {
+	TenantColumn() string
+}
+
+// tenantColumnOf 获取模型的租户列名，未开启行级多租户时返回空串
+func tenantColumnOf(model any, cfg RepoCfg) string {
+	if scoped, ok := model.(TenantScoped); ok && scoped.TenantColumn() != "" {
+		return scoped.TenantColumn()
+	}
+	return cfg.TenantColumn
+}
+
+// AcrossTenants 跨租户操作（管理任务使用），跳过租户条件与租户列赋值，返回新的 Repo 实例
+func (r *Repo[T, K]) AcrossTenants() IRepo[T, K] {
+	newRepo := r.cloneInternal()
+	newRepo.acrossTenants = true
+	return newRepo
+}
+
+// tenantScope 返回本次操作需要限定的租户；未开启或已跨租户时 scoped 为 false，上下文缺少租户时报错
+func (r *Repo[T, K]) tenantScope() (tenant string, scoped bool, err error) {
+	if r.tenantColumn == "" || r.acrossTenants {
+		return "", false, nil
+	}
+	tenant, ok := ds.TenantFromContext(r.context())
+	if !ok {
+		return "", false, fmt.Errorf("%s: %w", r.key, ds.ErrNoTenant)
+	}
+	return tenant, true, nil
+}
+
+// checkRawTenant 原生 SQL 无法自动追加租户条件，开启行级多租户时必须显式 AcrossTenants
+func (r *Repo[T, K]) checkRawTenant() error {
+	if r.tenantColumn == "" || r.acrossTenants {
+		return nil
+	}
+	return fmt.Errorf("%s: raw sql on tenant scoped repo requires AcrossTenants()", r.key)
+}
+
+// checkTenantSets 禁止通过 Set 修改租户列
+func (r *Repo[T, K]) checkTenantSets() error {
+	if r.tenantColumn == "" || r.acrossTenants {
+		return nil
+	}
+	for _, c := range r.match.Sets {
+		if c.Field == r.tenantColumn {
+			return fmt.Errorf("%s: tenant column %s can not be updated", r.key, r.tenantColumn)
+		}
+	}
+	return nil
+}
+
+// stampTenantIfScoped 开启行级多租户时为实体赋值租户列
+func (r *Repo[T, K]) stampTenantIfScoped(db *gorm.DB, ts ...*T) error {
+	tenant, scoped, err := r.tenantScope()
+	if err != nil || !scoped {
+		return err
+	}
+	return r.stampTenant(db, tenant, ts...)
+}
+
+// stampTenant 将租户ID写入实体的租户列
+func (r *Repo[T, K]) stampTenant(db *gorm.DB, tenant string, ts ...*T) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	field := sch.LookUpField(r.tenantColumn)
+	if field == nil {
+		return fmt.Errorf("%s: tenant column %s not found", r.key, r.tenantColumn)
+	}
+	for _, t := range ts {
+		if t == nil {
+			continue
+		}
+		if err := field.Set(r.context(), reflect.ValueOf(t).Elem(), tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"github.com/xiaojiecode/dubhe/db/ds"
+)
+
+type Invoice struct {
+	db.ModelI64
+	TenantID string `gorm:"index"`
+	Amount   int
+}
+
+func (Invoice) TableName() string { return "invoices" }
+func (Invoice) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, TenantColumn: "tenant_id"}
+}
+
+func TestTenantScoping(t *testing.T) {
+	cleanTables(t, "invoices")
+	repo := db.NewRepo[Invoice, int64]()
+	ctxA := ds.WithTenant(context.Background(), "a")
+	ctxB := ds.WithTenant(context.Background(), "b")
+	repoA, repoB := repo.WithCtx(&ctxA), repo.WithCtx(&ctxB)
+
+	// 新增自动赋值租户列，即使传入了其他租户
+	inv := &Invoice{TenantID: "b", Amount: 10}
+	if _, err := repoA.Create(inv); err != nil || inv.TenantID != "a" {
+		t.Fatalf("create should stamp tenant: %v, %+v", err, inv)
+	}
+	if _, err := repoB.CreateBatch([]*Invoice{{Amount: 20}, {Amount: 30}}); err != nil {
+		t.Fatalf("create batch failed: %v", err)
+	}
+
+	// 读取只返回本租户数据
+	if n, _ := repoA.Count(); n != 1 {
+		t.Fatalf("tenant a should see 1 invoice, got %d", n)
+	}
+	if list, _ := repoB.Where("amount > ?", 0).List(); len(list) != 2 {
+		t.Fatalf("tenant b should see 2 invoices, got %d", len(list))
+	}
+	if got, _ := repoB.GetByID(inv.ID); got != nil {
+		t.Fatal("tenant b must not read tenant a's invoice")
+	}
+
+	// 更新、删除限定在本租户
+	if n, _ := repoB.Set("amount", 99).Gt("amount", 0).Update(); n != 2 {
+		t.Fatalf("update should affect tenant b only, got %d", n)
+	}
+	if n, _ := repoB.Eq("id", inv.ID).Del(); n != 0 {
+		t.Fatal("tenant b must not delete tenant a's invoice")
+	}
+	if _, err := repoA.Set("tenant_id", "b").Eq("id", inv.ID).Update(); err == nil {
+		t.Fatal("tenant column must not be updated")
+	}
+
+	// 缺少租户、原生 SQL 拒绝执行
+	if _, err := repo.List(); !errors.Is(err, ds.ErrNoTenant) {
+		t.Fatalf("expected ErrNoTenant, got %v", err)
+	}
+	if _, err := repoA.Raw("SELECT * FROM invoices").List(); err == nil {
+		t.Fatal("raw query must require AcrossTenants")
+	}
+
+	// 跨租户
+	if n, _ := repo.AcrossTenants().Count(); n != 3 {
+		t.Fatalf("across tenants should see all invoices, got %d", n)
+	}
+	if list, err := repo.AcrossTenants().Raw("SELECT * FROM invoices").List(); err != nil || len(list) != 3 {
+		t.Fatalf("raw across tenants failed: %v, %d", err, len(list))
+	}
+}
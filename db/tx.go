@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrNoTx 在非事务 Repo 或未绑定事务的上下文上注册提交/回滚回调
+var ErrNoTx = errors.New("db: not in a transaction")
+
+// TxCallbackError 事务已提交（Committed 为 true）或已回滚，但有提交/回滚回调 panic，由 Commit/Rollback 返回；
+// 调用方不应据此重试事务。Panics 按执行顺序记录各回调的 panic 值
+type TxCallbackError struct {
+	Committed bool
+	Panics    []any
+}
+
+func (e *TxCallbackError) Error() string {
+	state := "rolled back"
+	if e.Committed {
+		state = "committed"
+	}
+	return fmt.Sprintf("db: tx %s, but %d callback(s) panicked: %v", state, len(e.Panics), e.Panics)
+}
+
+// txHooks 事务提交或回滚后执行的回调，同一事务的 Repo 副本共享
+type txHooks struct {
+	logger logger.Interface
+	ctx    context.Context
+
+	mu       sync.Mutex
+	commit   []func()
+	rollback []func()
+}
+
+// newTxHooks 创建事务回调，回调 panic 时通过 db 的 gorm logger 报告
+func newTxHooks(db *gorm.DB) *txHooks {
+	return &txHooks{logger: db.Logger, ctx: db.Statement.Context}
+}
+
+func (h *txHooks) onCommit(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commit = append(h.commit, fn)
+}
+
+func (h *txHooks) onRollback(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rollback = append(h.rollback, fn)
+}
+
+// take 取出并清空回调，committed 决定返回提交还是回滚回调
+func (h *txHooks) take(committed bool) []func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fns := h.rollback
+	if committed {
+		fns = h.commit
+	}
+	h.commit, h.rollback = nil, nil
+	return fns
+}
+
+// run 按注册顺序执行回调，单个回调 panic 不影响其余回调；有回调 panic 时返回 *TxCallbackError
+func (h *txHooks) run(committed bool) error {
+	var panics []any
+	for _, fn := range h.take(committed) {
+		if p := h.call(fn); p != nil {
+			panics = append(panics, p)
+		}
+	}
+	if len(panics) == 0 {
+		return nil
+	}
+	return &TxCallbackError{Committed: committed, Panics: panics}
+}
+
+// call 执行回调，返回其 panic 值；panic 同时通过 gorm logger 报告（含堆栈）
+func (h *txHooks) call(fn func()) (panicked any) {
+	defer func() {
+		if p := recover(); p != nil {
+			panicked = p
+			if h.logger != nil {
+				ctx := h.ctx
+				if ctx == nil {
+					ctx = context.Background()
+				}
+				h.logger.Error(ctx, "tx callback panic: %v\n%s", p, debug.Stack())
+			}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// runTxHooks 事务结束后执行回调，有回调 panic 时返回 *TxCallbackError
+func (r *Repo[T, K]) runTxHooks(committed bool) error {
+	if r.hooks == nil {
+		return nil
+	}
+	return r.hooks.run(committed)
+}
+
+// OnCommit 注册事务提交成功后执行的回调，按注册顺序执行；非事务 Repo 返回 ErrNoTx
+func (r *Repo[T, K]) OnCommit(fn func()) error {
+	if r.hooks == nil {
+		return ErrNoTx
+	}
+	r.hooks.onCommit(fn)
+	return nil
+}
+
+// OnRollback 注册事务回滚（含提交失败）后执行的回调，按注册顺序执行；非事务 Repo 返回 ErrNoTx
+func (r *Repo[T, K]) OnRollback(fn func()) error {
+	if r.hooks == nil {
+		return ErrNoTx
+	}
+	r.hooks.onRollback(fn)
+	return nil
+}
+
+// inTx 连接是否处于事务中
+func inTx(db *gorm.DB) bool {
+	if db == nil {
+		return false
+	}
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// region Context Tx
+
+type txBindingKey struct{}
+
+// txBinding 上下文绑定的事务
+type txBinding struct {
+	db    *gorm.DB
+	hooks *txHooks
+	err   error // 事务未能开启的错误，加入的 Repo 操作时返回
+}
+
+// TxContext 返回绑定 tx 所在事务的上下文：其它 Repo 通过 WithCtx 传入该上下文且使用同一连接时加入此事务，
+// 共享提交/回滚回调；tx 须为 Begin/Tx 返回的事务 Repo
+func TxContext[T IModel[K], K Key](ctx context.Context, tx IRepo[T, K]) context.Context {
+	r, ok := tx.(*Repo[T, K])
+	if ok && r.err != nil {
+		return context.WithValue(ctx, txBindingKey{}, &txBinding{err: r.err})
+	}
+	if !ok || r.hooks == nil || !inTx(r.db) {
+		panic(fmt.Sprintf("TxContext requires a transactional repo, got %T", tx))
+	}
+	return context.WithValue(ctx, txBindingKey{}, &txBinding{db: r.db, hooks: r.hooks})
+}
+
+func txBindingFrom(ctx context.Context) *txBinding {
+	if ctx == nil {
+		return nil
+	}
+	b, _ := ctx.Value(txBindingKey{}).(*txBinding)
+	return b
+}
+
+// OnCommit 注册上下文绑定事务提交成功后执行的回调；上下文未绑定事务时返回 ErrNoTx
+func OnCommit(ctx context.Context, fn func()) error {
+	b := txBindingFrom(ctx)
+	if b == nil {
+		return ErrNoTx
+	}
+	if b.err != nil {
+		return b.err
+	}
+	b.hooks.onCommit(fn)
+	return nil
+}
+
+// OnRollback 注册上下文绑定事务回滚后执行的回调；上下文未绑定事务时返回 ErrNoTx
+func OnRollback(ctx context.Context, fn func()) error {
+	b := txBindingFrom(ctx)
+	if b == nil {
+		return ErrNoTx
+	}
+	if b.err != nil {
+		return b.err
+	}
+	b.hooks.onRollback(fn)
+	return nil
+}
+
+// joinTx 上下文绑定了同一连接上的事务时加入该事务
+func (r *Repo[T, K]) joinTx() {
+	if r.bound {
+		return
+	}
+	b := txBindingFrom(r.context())
+	if b == nil {
+		return
+	}
+	if b.err != nil {
+		r.err = b.err
+		r.bound = true
+		return
+	}
+	db, err := r.conn()
+	if err != nil || !sameDialector(db.Dialector, b.db.Dialector) {
+		return
+	}
+	r.db = b.db
+	r.bound = true
+	r.hooks = b.hooks
+}
+
+// sameDialector 是否为同一连接（gorm 会话会复制 Config，Dialector 实例保持不变）
+func sameDialector(a, b gorm.Dialector) bool {
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// endregion Context Tx
@@ -0,0 +1,69 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTxCallbacks(t *testing.T) {
+	repo := db.NewRepo[Tag, int64]()
+	if err := repo.OnCommit(func() {}); !errors.Is(err, db.ErrNoTx) {
+		t.Fatalf("non-transactional repo should return ErrNoTx: %v", err)
+	}
+
+	// 按注册顺序执行，panic 不影响后续回调；logger 静默时 panic 仍由 Commit 返回
+	var calls []string
+	tx := repo.WithDB(testDB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})).Begin()
+	_ = tx.OnCommit(func() { calls = append(calls, "commit-1") })
+	_ = tx.OnCommit(func() { panic("boom") })
+	_ = tx.OnCommit(func() { calls = append(calls, "commit-2") })
+	_ = tx.OnRollback(func() { calls = append(calls, "rollback") })
+	if _, err := tx.Create(&Tag{Title: "t1"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Fatal("callbacks should wait for commit")
+	}
+	var cbErr *db.TxCallbackError
+	if err := tx.Commit(); !errors.As(err, &cbErr) || !cbErr.Committed || len(cbErr.Panics) != 1 || cbErr.Panics[0] != "boom" {
+		t.Fatalf("commit should report the panicking callback: %v", err)
+	}
+	if !slices.Equal(calls, []string{"commit-1", "commit-2"}) {
+		t.Fatalf("unexpected commit callbacks: %v", calls)
+	}
+	if n, _ := repo.Eq("title", "t1").Count(); n == 0 {
+		t.Fatal("commit should persist despite the panicking callback")
+	}
+
+	// 上下文绑定的事务：其它 Repo 加入同一事务并共享回调
+	calls = nil
+	tx = repo.Begin()
+	ctx := db.TxContext(context.Background(), tx)
+	_ = db.OnCommit(ctx, func() { calls = append(calls, "commit") })
+	_ = db.OnRollback(ctx, func() { calls = append(calls, "rollback") })
+	users := db.NewRepo[User, int64]().WithCtx(&ctx)
+	if _, err := users.Create(&User{Name: "tx-bound"}); err != nil {
+		t.Fatalf("create in bound tx failed: %v", err)
+	}
+	if err := users.OnRollback(func() { calls = append(calls, "users-rollback") }); err != nil {
+		t.Fatalf("bound repo should accept callbacks: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	if !slices.Equal(calls, []string{"rollback", "users-rollback"}) {
+		t.Fatalf("unexpected rollback callbacks: %v", calls)
+	}
+	if n, _ := db.NewRepo[User, int64]().Eq("name", "tx-bound").Count(); n != 0 {
+		t.Fatal("bound repo write should be rolled back")
+	}
+	if err := db.OnCommit(context.Background(), func() {}); !errors.Is(err, db.ErrNoTx) {
+		t.Fatalf("unbound context should return ErrNoTx: %v", err)
+	}
+}
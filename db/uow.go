@@ -0,0 +1,512 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// UnitOfWork 工作单元：登记多个 Repo 的新增、修改、删除实体，Commit 时在同一事务中按外键依赖顺序写入。
+// 新增按被依赖表在前的顺序每张表一次 CreateBatch，修改按同样顺序每张表按主键批量全字段更新，
+// 删除按相反顺序每张表按主键 IN 批量删除；所有 Repo 须使用同一连接且未处于事务中。
+// 登记按 Repo 实例归组，同一张表经不同实例（如不同 WithCtx、AcrossTenants）登记的实体分别写入
+type UnitOfWork struct {
+	mu    sync.Mutex
+	works []unitWork
+	index map[any]int // Repo 实例 -> works 下标
+}
+
+// unitWork 单个 Repo 登记的实体
+type unitWork interface {
+	// relations 表名与外键依赖边 [被依赖表, 依赖表]
+	relations() (string, [][2]string, error)
+	// begin 以该 Repo 的连接开启事务，返回绑定事务的上下文
+	begin(ctx context.Context) (context.Context, txControl, error)
+	// bind 返回加入上下文绑定事务的副本
+	bind(ctx context.Context) (unitWork, error)
+	insert() error
+	update() error
+	remove() error
+}
+
+// txControl 事务的提交与回滚
+type txControl interface {
+	Commit() error
+	Rollback() error
+}
+
+// NewUnitOfWork 创建工作单元
+func NewUnitOfWork() *UnitOfWork {
+	return &UnitOfWork{index: make(map[any]int)}
+}
+
+type unitKind int
+
+const (
+	unitNew unitKind = iota
+	unitDirty
+	unitRemoved
+)
+
+// RegisterNew 登记待新增的实体
+func RegisterNew[T IModel[K], K Key](u *UnitOfWork, repo IRepo[T, K], ts ...*T) {
+	register(u, repo, unitNew, ts)
+}
+
+// RegisterDirty 登记待全量更新的实体，同时登记为新增或删除的实体忽略
+func RegisterDirty[T IModel[K], K Key](u *UnitOfWork, repo IRepo[T, K], ts ...*T) {
+	register(u, repo, unitDirty, ts)
+}
+
+// RegisterRemoved 登记待删除的实体，同时登记为新增的实体视为取消，不写入也不删除
+func RegisterRemoved[T IModel[K], K Key](u *UnitOfWork, repo IRepo[T, K], ts ...*T) {
+	register(u, repo, unitRemoved, ts)
+}
+
+func register[T IModel[K], K Key](u *UnitOfWork, repo IRepo[T, K], kind unitKind, ts []*T) {
+	r, ok := repo.(*Repo[T, K])
+	if !ok {
+		panic(fmt.Sprintf("unit of work: unsupported repo %T", repo))
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var w *repoWork[T, K]
+	if i, ok := u.index[r]; ok {
+		w = u.works[i].(*repoWork[T, K])
+	} else {
+		w = &repoWork[T, K]{repo: r}
+		u.index[r] = len(u.works)
+		u.works = append(u.works, w)
+	}
+	for _, t := range ts {
+		if t == nil {
+			continue
+		}
+		switch kind {
+		case unitNew:
+			w.news = append(w.news, t)
+		case unitDirty:
+			w.dirty = append(w.dirty, t)
+		case unitRemoved:
+			w.removed = append(w.removed, t)
+		}
+	}
+}
+
+// Commit 在同一事务中写入全部登记的实体，成功后清空登记；失败时回滚并保留登记
+func (u *UnitOfWork) Commit(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.works) == 0 {
+		return nil
+	}
+	txCtx, tx, err := u.works[0].begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := u.flush(txCtx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		// 已提交、仅回调 panic 时同样清空登记，避免重复提交
+		var cbErr *TxCallbackError
+		if errors.As(err, &cbErr) && cbErr.Committed {
+			u.works, u.index = nil, make(map[any]int)
+		}
+		return err
+	}
+	u.works, u.index = nil, make(map[any]int)
+	return nil
+}
+
+// flush 按依赖顺序执行新增、修改，再按相反顺序执行删除
+func (u *UnitOfWork) flush(ctx context.Context) error {
+	works := make([]unitWork, len(u.works))
+	for i, w := range u.works {
+		bound, err := w.bind(ctx)
+		if err != nil {
+			return err
+		}
+		works[i] = bound
+	}
+	works, err := sortUnitWorks(works)
+	if err != nil {
+		return err
+	}
+	for _, w := range works {
+		if err := w.insert(); err != nil {
+			return err
+		}
+	}
+	for _, w := range works {
+		if err := w.update(); err != nil {
+			return err
+		}
+	}
+	for _, w := range slices.Backward(works) {
+		if err := w.remove(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortUnitWorks 按外键依赖拓扑排序：被依赖的表在前，无依赖关系的保持登记顺序
+func sortUnitWorks(works []unitWork) ([]unitWork, error) {
+	tables := make([]string, len(works))
+	index := make(map[string][]int, len(works)) // 同一张表可能由多个 Repo 实例登记
+	var edges [][2]string
+	for i, w := range works {
+		table, es, err := w.relations()
+		if err != nil {
+			return nil, err
+		}
+		tables[i] = table
+		index[table] = append(index[table], i)
+		edges = append(edges, es...)
+	}
+	after := make([][]int, len(works))
+	indegree := make([]int, len(works))
+	seen := make(map[[2]int]bool)
+	for _, e := range edges {
+		if e[0] == e[1] {
+			// 自引用的表无法按表排序
+			continue
+		}
+		for _, from := range index[e[0]] {
+			for _, to := range index[e[1]] {
+				if from == to || seen[[2]int{from, to}] {
+					continue
+				}
+				seen[[2]int{from, to}] = true
+				after[from] = append(after[from], to)
+				indegree[to]++
+			}
+		}
+	}
+	res := make([]unitWork, 0, len(works))
+	done := make([]bool, len(works))
+	for len(res) < len(works) {
+		next := -1
+		for i := range works {
+			if !done[i] && indegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i, table := range tables {
+				if !done[i] {
+					cycle = append(cycle, table)
+				}
+			}
+			return nil, fmt.Errorf("unit of work: foreign key cycle between %s", strings.Join(cycle, ", "))
+		}
+		done[next] = true
+		res = append(res, works[next])
+		for _, to := range after[next] {
+			indegree[to]--
+		}
+	}
+	return res, nil
+}
+
+// repoWork 单个 Repo 登记的实体
+type repoWork[T IModel[K], K Key] struct {
+	repo    *Repo[T, K]
+	news    []*T
+	dirty   []*T
+	removed []*T
+}
+
+func (w *repoWork[T, K]) relations() (string, [][2]string, error) {
+	db, err := w.repo.conn()
+	if err != nil {
+		return "", nil, err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return "", nil, err
+	}
+	var edges [][2]string
+	for _, rel := range sch.Relationships.BelongsTo {
+		edges = append(edges, [2]string{rel.FieldSchema.Table, w.repo.table})
+	}
+	for _, rels := range [][]*schema.Relationship{sch.Relationships.HasOne, sch.Relationships.HasMany} {
+		for _, rel := range rels {
+			edges = append(edges, [2]string{w.repo.table, rel.FieldSchema.Table})
+		}
+	}
+	return w.repo.table, edges, nil
+}
+
+func (w *repoWork[T, K]) begin(ctx context.Context) (context.Context, txControl, error) {
+	c := w.repo.cloneInternal()
+	c.ctx = &ctx
+	tx, err := c.beginTx()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tx.db.Error != nil {
+		return nil, nil, tx.db.Error
+	}
+	return TxContext[T, K](ctx, tx), tx, nil
+}
+
+func (w *repoWork[T, K]) bind(ctx context.Context) (unitWork, error) {
+	c := w.repo.cloneInternal()
+	c.ctx = &ctx
+	c.joinTx()
+	if b := txBindingFrom(ctx); b == nil || c.hooks != b.hooks {
+		return nil, fmt.Errorf("%s: unit of work requires repos on the same connection outside a transaction", w.repo.key)
+	}
+	// 同时登记为新增与删除的实体视为取消；修改只保留既不新增也不删除的实体
+	removed := make(map[*T]bool, len(w.removed))
+	for _, t := range w.removed {
+		removed[t] = true
+	}
+	created := make(map[*T]bool, len(w.news))
+	bound := &repoWork[T, K]{repo: c}
+	for _, t := range w.news {
+		if !removed[t] && !created[t] {
+			bound.news = append(bound.news, t)
+		}
+		created[t] = true
+	}
+	dirty := make(map[*T]bool, len(w.dirty))
+	for _, t := range w.dirty {
+		if !created[t] && !removed[t] && !dirty[t] {
+			bound.dirty = append(bound.dirty, t)
+		}
+		dirty[t] = true
+	}
+	deleted := make(map[*T]bool, len(w.removed))
+	for _, t := range w.removed {
+		if !created[t] && !deleted[t] {
+			bound.removed = append(bound.removed, t)
+		}
+		deleted[t] = true
+	}
+	return bound, nil
+}
+
+func (w *repoWork[T, K]) insert() error {
+	if len(w.news) == 0 {
+		return nil
+	}
+	_, err := w.repo.CreateBatch(w.news)
+	return err
+}
+
+func (w *repoWork[T, K]) update() error {
+	if len(w.dirty) == 0 {
+		return nil
+	}
+	_, err := w.repo.updateFullBatch(w.dirty)
+	return err
+}
+
+func (w *repoWork[T, K]) remove() error {
+	if len(w.removed) == 0 {
+		return nil
+	}
+	size, err := w.repo.idChunkSize()
+	if err != nil {
+		return err
+	}
+	ids := make([]K, len(w.removed))
+	for i, t := range w.removed {
+		ids[i] = (*t).GetID()
+	}
+	for chunk := range slices.Chunk(ids, size) {
+		field, values, err := w.repo.keysIn(chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := w.repo.In(field, values).Del(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// region Bulk Update
+
+// updateFullBatch 按主键批量全字段更新：每批一条 UPDATE，各列为按主键取值的 CASE 表达式，
+// 与 UpdateFull 一致跳过实体中的零值字段（该行保留原值）；拦截器按一次 OpUpdateFull 调用，分表时逐条更新
+func (r *Repo[T, K]) updateFullBatch(ts []*T) (int64, error) {
+	var n int64
+	err := r.intercept(OpUpdateFull, ts, &n, func(c *Repo[T, K]) (err error) {
+		if c.sharded() {
+			for _, t := range ts {
+				affected, err := c.updateFull(t)
+				if err != nil {
+					return err
+				}
+				n += affected
+			}
+			return nil
+		}
+		n, err = c.bulkUpdateFull(ts)
+		return err
+	})
+	return n, err
+}
+
+func (r *Repo[T, K]) bulkUpdateFull(ts []*T) (int64, error) {
+	if r.writeTxNeeded() {
+		return r.inWriteTx(func(c *Repo[T, K]) (int64, error) { return c.bulkUpdateFull(ts) })
+	}
+	db, err := r.writeDB()
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range ts {
+		if err := r.stampUpdated(db, t); err != nil {
+			return 0, err
+		}
+	}
+	if err := r.stampTenantIfScoped(db, ts...); err != nil {
+		return 0, err
+	}
+	size, err := r.idChunkSize()
+	if err != nil {
+		return 0, err
+	}
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return 0, err
+	}
+	// 每行在每列的 CASE 中占用主键与取值的占位符
+	size = max(1, size/(len(sch.DBNames)+1))
+	var n int64
+	for chunk := range slices.Chunk(ts, size) {
+		affected, err := r.bulkUpdateChunk(db, sch, chunk)
+		if err != nil {
+			return 0, err
+		}
+		n += affected
+	}
+	return n, nil
+}
+
+func (r *Repo[T, K]) bulkUpdateChunk(db *gorm.DB, sch *schema.Schema, ts []*T) (int64, error) {
+	cols, err := r.keyColumns()
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]K, len(ts))
+	for i, t := range ts {
+		ids[i] = (*t).GetID()
+	}
+	// 每行的主键条件，复合主键为多列 AND
+	conds := make([]string, len(cols))
+	for i, c := range cols {
+		conds[i] = db.Statement.Quote(c.column) + " = ?"
+	}
+	when := "WHEN " + strings.Join(conds, " AND ") + " THEN ?"
+
+	// CASE 表达式不经过写入回调的加密，以回调相同的方式取得加解密器（statementCipher）并逐值 seal
+	stmt := db.Session(&gorm.Session{NewDB: true})
+	stmt.Statement.Schema = sch
+	cipher, fields, _ := statementCipher(stmt)
+	if stmt.Error != nil {
+		return 0, stmt.Error
+	}
+	encrypted := make(map[*schema.Field]encryptedField, len(fields))
+	for _, ef := range fields {
+		encrypted[ef.field] = ef
+	}
+
+	ctx := r.context()
+	type caseExpr struct {
+		sql  []string
+		args []any
+	}
+	cases := make(map[string]*caseExpr)
+	var order []string
+	add := func(column string, id K, value any) {
+		c, ok := cases[column]
+		if !ok {
+			c = &caseExpr{}
+			cases[column] = c
+			order = append(order, column)
+		}
+		c.sql = append(c.sql, when)
+		for _, kc := range cols {
+			c.args = append(c.args, kc.value(id))
+		}
+		c.args = append(c.args, value)
+	}
+	for i, t := range ts {
+		rv := reflect.ValueOf(t).Elem()
+		for _, field := range sch.Fields {
+			if field.DBName == "" || field.PrimaryKey || !field.Updatable || field.AutoCreateTime > 0 ||
+				field.AutoUpdateTime > 0 || slices.Contains(r.omits, field.DBName) || slices.Contains(r.omits, field.Name) {
+				continue
+			}
+			value, zero := field.ValueOf(ctx, rv)
+			if zero {
+				continue
+			}
+			ef, ok := encrypted[field]
+			if !ok {
+				add(field.DBName, ids[i], value)
+				continue
+			}
+			sealed, index, err := cipher.seal(sch.Table, ef, value)
+			if err != nil {
+				return 0, err
+			}
+			add(field.DBName, ids[i], sealed)
+			if ef.index != nil {
+				add(ef.index.DBName, ids[i], index)
+			}
+		}
+	}
+	if len(cases) == 0 {
+		return 0, nil
+	}
+	sets := make(map[string]any, len(cases))
+	for _, column := range order {
+		c := cases[column]
+		sets[column] = gorm.Expr("CASE "+strings.Join(c.sql, " ")+" ELSE "+db.Statement.Quote(column)+" END", c.args...)
+	}
+
+	newRepo := r.cloneInternal()
+	field, values, err := newRepo.keysIn(ids)
+	if err != nil {
+		return 0, err
+	}
+	newRepo.match.In(field, values)
+	sql, args := newRepo.match.WhereSql()
+	before, err := newRepo.auditImages(ids)
+	if err != nil {
+		return 0, err
+	}
+	result := db.Model(new(T)).Where(sql, args...).Updates(sets)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	newRepo.invalidate(ids...)
+	if err := newRepo.auditAfter(OpUpdateFull, before); err != nil {
+		return 0, err
+	}
+	if result.RowsAffected > 0 {
+		if err := newRepo.emit(OpUpdateFull, ids, ts, nil); err != nil {
+			return 0, err
+		}
+	}
+	return result.RowsAffected, nil
+}
+
+// endregion Bulk Update
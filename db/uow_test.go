@@ -0,0 +1,130 @@
+package db_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xiaojiecode/dubhe/db"
+)
+
+type opsKey struct{}
+
+// recordOps 将写操作记录到上下文携带的 *[]string，用于断言工作单元内各 Repo 的写入顺序
+func recordOps(ctx context.Context, op db.Operation, next func() error) error {
+	if ops, ok := ctx.Value(opsKey{}).(*[]string); ok {
+		*ops = append(*ops, string(op.Kind())+":"+op.Key())
+	}
+	return next()
+}
+
+// isOp 操作记录是否为 table 表上的 kind 操作（Key 为数据源 + 表名）
+func isOp(s string, kind db.OpKind, table string) bool {
+	return strings.HasPrefix(s, string(kind)+":") && strings.HasSuffix(s, table)
+}
+
+type Basket struct {
+	db.ModelI64
+	Owner string
+}
+
+func (Basket) TableName() string { return "baskets" }
+func (Basket) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Interceptors: []db.Interceptor{recordOps}}
+}
+
+type BasketLine struct {
+	db.ModelI64
+	BasketID int64
+	Basket   *Basket
+	Sku      string
+}
+
+func (BasketLine) TableName() string { return "basket_lines" }
+func (BasketLine) RepoDefine() db.RepoCfg {
+	return db.RepoCfg{DB: testDB, AutoMigrate: true, Interceptors: []db.Interceptor{recordOps}}
+}
+
+func TestUnitOfWork(t *testing.T) {
+	cleanTables(t, "baskets", "basket_lines")
+	baskets := db.NewRepo[Basket, int64]()
+	lines := db.NewRepo[BasketLine, int64]()
+	var uowOps []string
+	ctx := context.WithValue(context.Background(), opsKey{}, &uowOps)
+
+	// 先登记依赖方，提交时仍按外键依赖先写入被依赖表
+	basket := &Basket{Owner: "alice"}
+	l1 := &BasketLine{Basket: basket, Sku: "a"}
+	l2 := &BasketLine{Basket: basket, Sku: "b"}
+	cancelled := &BasketLine{Basket: basket, Sku: "x"}
+	u := db.NewUnitOfWork()
+	db.RegisterNew(u, lines, l1, l2, cancelled)
+	other := &Basket{Owner: "dave"}
+	db.RegisterNew(u, baskets, basket, other)
+	db.RegisterRemoved(u, lines, cancelled)
+	uowOps = nil
+	if err := u.Commit(ctx); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if len(uowOps) != 2 || !isOp(uowOps[0], db.OpCreateBatch, "baskets") || !isOp(uowOps[1], db.OpCreateBatch, "basket_lines") {
+		t.Fatalf("unexpected write order: %v", uowOps)
+	}
+	if l1.BasketID != basket.ID || l2.BasketID != basket.ID {
+		t.Fatalf("foreign keys should be set: %+v %+v", l1, l2)
+	}
+	if n, _ := lines.Eq("basket_id", basket.ID).Count(); n != 2 {
+		t.Fatalf("cancelled line should not be inserted: %d", n)
+	}
+
+	// 修改先于删除执行，删除按相反顺序先删依赖方；同时登记删除的实体不再修改
+	other.Owner = "erin"
+	basket.Owner = "bob"
+	u = db.NewUnitOfWork()
+	db.RegisterRemoved(u, baskets, basket)
+	db.RegisterRemoved(u, lines, l1, l2)
+	db.RegisterDirty(u, baskets, other, basket)
+	uowOps = nil
+	if err := u.Commit(ctx); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if len(uowOps) != 3 || !isOp(uowOps[0], db.OpUpdateFull, "baskets") ||
+		!isOp(uowOps[1], db.OpDel, "basket_lines") || !isOp(uowOps[2], db.OpDel, "baskets") {
+		t.Fatalf("unexpected write order: %v", uowOps)
+	}
+	if n, _ := lines.Eq("basket_id", basket.ID).Count(); n != 0 {
+		t.Fatal("lines should be deleted")
+	}
+	if got, _ := baskets.GetByID(other.ID); got == nil || got.Owner != "erin" {
+		t.Fatalf("dirty basket should be updated: %+v", got)
+	}
+
+	// 同一 Repo 实例登记的修改每张表一条批量 UPDATE，零值字段保留原值；不同实例登记的分别写入
+	b1, b2, b3 := &Basket{Owner: "f"}, &Basket{Owner: "g"}, &Basket{Owner: "h"}
+	_, _ = baskets.CreateBatch([]*Basket{b1, b2, b3})
+	b1.Owner, b3.Owner = "f2", "h2"
+	u = db.NewUnitOfWork()
+	db.RegisterDirty(u, baskets, b1, &Basket{ModelI64: db.ModelI64{ID: b2.ID}})
+	db.RegisterDirty(u, baskets.WithCtx(&ctx), b3)
+	uowOps = nil
+	if err := u.Commit(ctx); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if len(uowOps) != 2 || !isOp(uowOps[0], db.OpUpdateFull, "baskets") || !isOp(uowOps[1], db.OpUpdateFull, "baskets") {
+		t.Fatalf("expected one bulk update per repo: %v", uowOps)
+	}
+	m, _ := baskets.GetByIDs([]int64{b1.ID, b2.ID, b3.ID})
+	if len(m) != 3 || m[b1.ID].Owner != "f2" || m[b2.ID].Owner != "g" || m[b3.ID].Owner != "h2" {
+		t.Fatalf("bulk update failed: %+v %+v %+v", m[b1.ID], m[b2.ID], m[b3.ID])
+	}
+
+	// 任一写入失败时整体回滚
+	u = db.NewUnitOfWork()
+	db.RegisterNew(u, baskets, &Basket{Owner: "carol"})
+	db.RegisterNew(u, lines, &BasketLine{ModelI64: db.ModelI64{ID: l2.ID}, Sku: "dup"})
+	if err := u.Commit(ctx); err == nil {
+		t.Fatal("duplicate primary key should fail the unit of work")
+	}
+	if n, _ := baskets.Eq("owner", "carol").Count(); n != 0 {
+		t.Fatal("failed unit of work should roll back")
+	}
+}